@@ -0,0 +1,48 @@
+package commandflags
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// BatchResult is the outcome of one line processed by ProcessBatch.
+type BatchResult struct {
+	Line   int      // line number in the input, starting at 1
+	Args   []string // the arguments the line was split into
+	Result *Result  // as returned by Process, or nil if the line is malformed
+	Err    error    // the Error returned by Process, or why the line is malformed
+}
+
+// ProcessBatch processes each line read from r as a command line, as with
+// Process, so that the resolved command's Run handler is called. Lines are
+// split into arguments as by REPL; blank lines and lines starting with #
+// are skipped. Each line is processed independently of those before it,
+// and an error processing one does not stop the batch. ProcessBatch
+// returns an error only if reading r fails, along with the results of the
+// lines read until then.
+func (c *CommandType) ProcessBatch(r io.Reader) ([]BatchResult, error) {
+	results := []BatchResult{}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		if strings.HasPrefix(strings.TrimSpace(sc.Text()), "#") {
+			continue
+		}
+		args, err := splitLine(sc.Text())
+		if err != nil {
+			results = append(results, BatchResult{Line: line, Err: err})
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		br := BatchResult{Line: line, Args: args}
+		res, perr := c.Process(args)
+		br.Result = res
+		if perr != nil {
+			br.Err = perr
+		}
+		results = append(results, br)
+	}
+	return results, sc.Err()
+}
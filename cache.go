@@ -0,0 +1,84 @@
+package commandflags
+
+import (
+	"sync"
+	"text/template"
+
+	"github.com/jagipson/refmt"
+)
+
+// A HelpCache holds a command's rendered help so that it is not rebuilt each
+// time it is needed. The zero value is an empty cache ready to use. It is
+// safe for concurrent use, including by copies of the command sharing it.
+type HelpCache struct {
+	mu   sync.Mutex
+	help map[helpKey]string
+}
+
+// helpKey identifies a rendering of a command's help. As the copy of a
+// sub-command processed by ProcessArgs shares its HelpCache with the one in
+// its parent's SubCommands, but may have inherited flags and settings the
+// other lacks, those are part of the key too.
+type helpKey struct {
+	width    int                // the width wrapped to
+	indent   int                // the indent in effect
+	color    bool               // whether the help is colored
+	flags    string             // the names of the flags shown
+	colWidth int                // MaxFlagColWidth
+	style    *refmt.Style       // Style
+	tmpl     *template.Template // HelpTemplate
+}
+
+// get returns the help cached under k, if any.
+func (h *HelpCache) get(k helpKey) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	help, ok := h.help[k]
+	return help, ok
+}
+
+// put caches help under k.
+func (h *HelpCache) put(k helpKey, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.help == nil {
+		h.help = map[helpKey]string{}
+	}
+	h.help[k] = help
+}
+
+// Invalidate empties the cache.
+func (h *HelpCache) Invalidate() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.help = nil
+}
+
+// CacheHelp gives c and each of its descendants a new, empty HelpCache.
+func (c *CommandType) CacheHelp() {
+	c.cacheHelp([]string{c.Name})
+}
+
+// cacheHelp implements CacheHelp for c, reached by path.
+func (c *CommandType) cacheHelp(path []string) {
+	c.HelpCache = &HelpCache{}
+	if tooDeep(path) != nil {
+		return
+	}
+	for n, sc := range c.SubCommands {
+		sc.cacheHelp(append(path[:len(path):len(path)], n))
+		c.SubCommands[n] = sc
+	}
+}
+
+// InvalidateHelpCache empties the HelpCache of c and each of its
+// descendants, for use after modifying the command tree other than with
+// AddSubCommand.
+func (c CommandType) InvalidateHelpCache() {
+	c.Walk(func(path []string, cmd CommandType) error {
+		if cmd.HelpCache != nil {
+			cmd.HelpCache.Invalidate()
+		}
+		return nil
+	})
+}
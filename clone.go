@@ -0,0 +1,118 @@
+package commandflags
+
+import (
+	"flag"
+	"reflect"
+	"time"
+)
+
+// Clone returns a copy of the command tree that can be processed
+// independently of c, for example by a server handling several command lines
+// at once, each in its own goroutine with its own clone:
+//
+//	cmd := tree.Clone()
+//	res, err := cmd.Process(args)
+//
+// The SubCommands maps are copied and each FlagSet is replaced by a new one
+// defining the same flags; a FlagSet shared by several commands is replaced
+// by a single new FlagSet shared in the same way. The values of flags of the
+// types defined by the flag package are backed by new variables, each shared
+// by the same flags as the value it replaces, such as the two names of a
+// flag paired by AliasFlag, so the clone's values must be read from its own
+// flags, e.g. through Result.Flags or Flags.Lookup, rather than through the
+// variables the original flags were defined with. Other flag.Value implementations cannot be copied and are
+// shared with c, as are Run handlers and the other fields of each command,
+// except that each HelpCache is replaced by a new, empty one.
+func (c CommandType) Clone() CommandType {
+	return c.clone([]string{c.Name}, map[*flag.FlagSet]*flag.FlagSet{}, map[flag.Value]flag.Value{})
+}
+
+// clone implements Clone for c, reached by path, where flagSets maps the
+// FlagSets already cloned to their clones and values the flag values already
+// cloned to theirs.
+func (c CommandType) clone(path []string, flagSets map[*flag.FlagSet]*flag.FlagSet, values map[flag.Value]flag.Value) CommandType {
+	if c.Flags != nil {
+		fs, ok := flagSets[c.Flags]
+		if !ok {
+			fs = cloneFlagSet(c.Flags, values)
+			flagSets[c.Flags] = fs
+		}
+		c.Flags = fs
+	}
+	if c.HelpCache != nil {
+		c.HelpCache = &HelpCache{}
+	}
+	if c.SubCommands == nil || tooDeep(path) != nil {
+		return c
+	}
+	subs := make(map[string]CommandType, len(c.SubCommands))
+	for n, sc := range c.SubCommands {
+		subs[n] = sc.clone(append(path[:len(path):len(path)], n), flagSets, values)
+	}
+	c.SubCommands = subs
+	return c
+}
+
+// cloneFlagSet returns a new FlagSet defining the same flags as fs, with the
+// same defaults, backed by new values where cloneValue can make them. A value
+// in values is replaced by the clone it maps to, and the values cloned are
+// added to it.
+func cloneFlagSet(fs *flag.FlagSet, values map[flag.Value]flag.Value) *flag.FlagSet {
+	clone := flag.NewFlagSet(fs.Name(), fs.ErrorHandling())
+	clone.SetOutput(fs.Output())
+	clone.Usage = fs.Usage
+	fs.VisitAll(func(f *flag.Flag) {
+		var v flag.Value
+		if !reflect.TypeOf(f.Value).Comparable() {
+			v = cloneValue(f)
+		} else if v = values[f.Value]; v == nil {
+			v = cloneValue(f)
+			values[f.Value] = v
+		}
+		clone.Var(v, f.Name, f.Usage)
+		clone.Lookup(f.Name).DefValue = f.DefValue
+	})
+	return clone
+}
+
+// cloneValue returns a new Value of the same type as f's, holding f's
+// default, if it is one of the flag package's or this package's own types,
+// and otherwise f's own Value.
+func cloneValue(f *flag.Flag) flag.Value {
+	switch f.Value.(type) {
+	case *helpFlag:
+		return new(helpFlag)
+	case *versionFlag:
+		return new(versionFlag)
+	}
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return f.Value
+	}
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	switch v := g.Get().(type) {
+	case bool:
+		fs.Bool("v", v, "")
+	case int:
+		fs.Int("v", v, "")
+	case int64:
+		fs.Int64("v", v, "")
+	case uint:
+		fs.Uint("v", v, "")
+	case uint64:
+		fs.Uint64("v", v, "")
+	case string:
+		fs.String("v", v, "")
+	case float64:
+		fs.Float64("v", v, "")
+	case time.Duration:
+		fs.Duration("v", v, "")
+	default:
+		return f.Value
+	}
+	nv := fs.Lookup("v").Value
+	if reflect.TypeOf(nv) != reflect.TypeOf(f.Value) || nv.Set(f.DefValue) != nil {
+		return f.Value // a Value of the user's own type
+	}
+	return nv
+}
@@ -1,19 +1,101 @@
 package commandflags
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
 
 	"github.com/jagipson/refmt"
+	"golang.org/x/term"
 )
 
-// HelpIndent sets the number of spaces each subcommand's help is indented
+// HelpIndent sets the number of spaces each subcommand's help is indented,
+// unless overridden by CommandType.Indent
 var HelpIndent int = 2
 
 // DefaultWidth is the default screen/term width assumed when wrapping text
-// for help output.
+// for help output, unless overridden by CommandType.Width.
 var DefaultWidth int = 80
 
+// Color enables ANSI colors for command names, flag names and section headers
+// in help. PrintHelp also enables colors when writing to a terminal. Colors
+// are never used when the NO_COLOR environment variable is set.
+var Color = false
+
+// ANSI escapes used to color help
+const (
+	colorHeader  = "\x1b[1m"
+	colorCommand = "\x1b[36m"
+	colorFlag    = "\x1b[33m"
+	colorReset   = "\x1b[0m"
+)
+
+// HelpHeaderFormat is the format of the first line of help, with a %s for
+// the command's name. Help has no header when it is empty.
+var HelpHeaderFormat = "Command: %s\n"
+
+// FlagsSectionLabel and SubCommandsSectionLabel are the formats of the
+// headings above a command's flags, other than those in FlagGroups, and its
+// sub-commands in help, with a %s for the command's name.
+var (
+	FlagsSectionLabel       = "%s flags:"
+	SubCommandsSectionLabel = "%s sub-commands:"
+)
+
+// GlobalFlagsSectionLabel is the heading above the flags a command inherits
+// through InheritFlags, other than those in FlagGroups, which are listed in
+// help after its own flags.
+var GlobalFlagsSectionLabel = "Global flags:"
+
+// ExamplesSectionLabel is the heading above a command's Examples in help.
+var ExamplesSectionLabel = "Examples:"
+
+// FlagPrefix is shown before the name of each flag in help, e.g. "--" to
+// show --verbose. It does not affect parsing, which accepts one or two
+// dashes regardless.
+var FlagPrefix = "-"
+
+// FlagValueSeparator separates the name of each flag taking a value from the
+// placeholder for its value in help. Flags may be given on the command line
+// either as -name value or as -name=value, with one or two dashes; setting
+// this to "=" documents the latter form, e.g. -m=INT rather than -m INT.
+var FlagValueSeparator = " "
+
+// ShowSynopsis adds a usage line generated by Synopsis below the header of
+// help.
+var ShowSynopsis = false
+
+// ShowTagline shows a command's ShortDesc as a tagline below the header of
+// its help when it also has a LongDesc, which follows as usual. Otherwise,
+// only the LongDesc is shown.
+var ShowTagline = false
+
+// HelpCommandName is the name of the sub-command that ProcessArgs treats as a
+// request for help. Its arguments are taken as the path, relative to the
+// help command's parent, of the command whose help is wanted.
+var HelpCommandName = "help"
+
+// MaxDepth is the greatest number of levels, counting the root, that a
+// command tree may have. It guards against trees whose SubCommands refer back
+// to themselves, which would otherwise be followed forever.
+var MaxDepth = 32
+
+// HelpFlagNames are the names of the boolean flags that ProcessArgs accepts
+// on every command, unless its flagset defines a flag of the same name, as a
+// request for that command's help. They are defined only in the copy of the
+// flagset ProcessArgs parses, not the flagset itself, and are not listed in
+// help. Set it to nil to define no help flags.
+var HelpFlagNames = []string{"h", "help"}
+
 // CommandType implements a nested Command-flag structure whereby options
 // (flags) are processed, and then subcommands are processed. Each subcommand
 // is another commandType and the process recurses, each having it's own flag
@@ -21,17 +103,328 @@ var DefaultWidth int = 80
 // available subcommands. The LongDesc is displayed at the top of the help for
 // the command, and the Help is displayed at the bottom. The Help is often
 // used to explain the interaction between flags or expand upon flag
-// documentation. The flagset will be renamed, to the name of the command, and
-// the flag.FlagSet error handling will be reset to flag.ContinueOnError. This
-// allows the error handling to be done by commandflags and the downstream
-// program.
+// documentation. While its arguments are parsed, the flagset will be renamed,
+// to the name of the command, and the flag.FlagSet error handling will be
+// reset to flag.ContinueOnError. This allows the error handling to be done by
+// commandflags and the downstream program. The flagset's name, error handling,
+// output and Usage are restored afterwards, and its flags are reset to their
+// defaults before each parse, so a flagset may safely be shared by several
+// commands and a command processed more than once. If Run is set on the
+// command that ProcessArgs resolves to, it is called with the remaining
+// non-flag arguments.
 type CommandType struct {
 	Name        string                 // Name of command
 	ShortDesc   string                 // Short description of subcommand
 	LongDesc    string                 // Detailed description of subcommand
 	Help        string                 // Documentation of subcommand
-	Flags       *flag.FlagSet          // Flagset for command
+	Flags       *flag.FlagSet          // Flagset for command; nil if it takes no flags
 	SubCommands map[string]CommandType // map of subcommands
+	Run         func([]string) error   // handler for leaf command, or nil
+	Aliases     []string               // alternate names for subcommand
+	Hidden      bool                   // omit from parent's help listing
+
+	// CaseInsensitive makes ProcessArgs match sub-command names and aliases
+	// regardless of case when there is no exact match. The canonical Name is
+	// still what is returned in the command path.
+	CaseInsensitive bool
+
+	// AllowPrefixMatch makes ProcessArgs accept an unambiguous prefix of a
+	// visible sub-command's name or alias, e.g. "dep" for "deploy". An
+	// ambiguous prefix results in an InvalidCommandError listing the
+	// candidates in alphabetical order, e.g. "Ambiguous COMMAND 'dep':
+	// deploy, deployments".
+	AllowPrefixMatch bool
+
+	// RunContext is like Run but also receives the context passed to
+	// ProcessArgsContext, or context.Background() from ProcessArgs. If both
+	// are set, RunContext is called instead of Run.
+	RunContext func(context.Context, []string) error
+
+	// RequiredFlags lists the names of flags in Flags that must be set on
+	// the command line. ProcessArgs returns a FlagError naming every
+	// required flag that was not provided.
+	RequiredFlags []string
+
+	// ValidateFlags, if set, is called after the command's flags have been
+	// parsed and checked, for validation that RequiredFlags and
+	// MutuallyExclusive cannot express, such as one flag's value depending
+	// on another's. An error it returns is reported as a FlagError.
+	ValidateFlags func() error
+
+	// CollectAllFlagErrors makes ProcessArgs continue parsing flags after an
+	// error, so that the FlagError lists every bad flag on the command line
+	// rather than just the first.
+	CollectAllFlagErrors bool
+
+	// NormalizeFlagName, when set, maps a flag name to a canonical form,
+	// such as by replacing underscores with dashes, so that flags on the
+	// command line match the defined flag with the same normalized name,
+	// e.g. -max-retries for a flag defined as max_retries. A name that
+	// matches a flag exactly is always taken as that flag. Where several
+	// flags normalize to the same name, a name matching neither exactly is
+	// taken as the first of them in lexical order. Only the command line is
+	// normalized, not DefaultsFile, EnvVars or flag names in other fields.
+	// Subcommands without their own NormalizeFlagName inherit their
+	// parent's.
+	NormalizeFlagName func(string) string
+
+	// AllowBundledShortFlags lets single-letter boolean flags be combined
+	// behind one dash, as with getopt, so that -vd is taken as -v -d. Only
+	// tokens with a single dash and no "=" that do not name a flag
+	// themselves are expanded, so a flag such as -vd, if defined, still
+	// takes precedence, and tokens starting with "--" are left alone. Every
+	// letter in an expanded token must be a boolean flag; a flag taking a
+	// value cannot be bundled, even as the last letter, and a token that
+	// cannot be expanded results in a FlagError, even with
+	// PassUnknownFlags.
+	AllowBundledShortFlags bool
+
+	// ExpandResponseFiles makes ProcessArgs replace each argument of the
+	// form @path given to the command with the arguments read from the file
+	// at path, for command lines too long to type or for the shell to pass.
+	// The file's arguments are separated by white space, including newlines,
+	// and may be quoted as in a shell; arguments read from a file are not
+	// themselves expanded. An argument that should start with @ is written
+	// with @@, and arguments following "--" are never expanded. The
+	// expansion is done once, by the first command that has
+	// ExpandResponseFiles set, for all of the arguments that follow its
+	// name. A file that cannot be read results in a FlagError.
+	ExpandResponseFiles bool
+
+	// MutuallyExclusive lists groups of flag names of which at most one may
+	// be set on the command line. ProcessArgs returns a FlagError naming the
+	// conflicting flags of every group with more than one set. Flags set
+	// from the environment or DefaultsFile are not counted.
+	MutuallyExclusive [][]string
+
+	// SubCommandOrder optionally lists subcommand names in the order they
+	// should appear in help. Subcommands not listed follow in alphabetical
+	// order. When empty, all subcommands are listed alphabetically.
+	SubCommandOrder []string
+
+	// SubCommandGroups lists sub-commands to be shown under their own
+	// headings in help. Visible sub-commands not in any group are listed
+	// under the usual SubCommandsSectionLabel heading after the groups.
+	SubCommandGroups []SubCommandGroup
+
+	// MinArgs and MaxArgs bound the number of positional arguments a command
+	// without sub-commands accepts; a MaxArgs of -1 means unlimited. When
+	// both are zero the arguments are not checked. ProcessArgs returns an
+	// ArgCountError when the count falls outside the range.
+	MinArgs int
+	MaxArgs int
+
+	// ArgNames names the command's positional arguments, in order, for
+	// Synopsis and for the ArgCountError returned when too few are given,
+	// e.g. "deploy: missing argument REV". The last name is repeated for
+	// any further arguments; without names, ARG is used.
+	ArgNames []string
+
+	// Indent and Width, when non-zero, override the package-level HelpIndent
+	// and DefaultWidth when rendering this command's help. A Width passed
+	// explicitly to RenderHelp still takes precedence over both. Subcommands
+	// reached through ProcessArgs inherit their parent's values unless they
+	// set their own.
+	Indent int
+	Width  int
+
+	// MaxFlagColWidth, when non-zero, caps the width of the column of flag
+	// names, including the indent, in help, so that a few long flag names
+	// do not squeeze the usage of every flag into a narrow column. A flag
+	// whose name and label are wider is shown on a line of its own, with
+	// its usage on the lines below at the indent of the other flags'
+	// usage. Subcommands reached through ProcessArgs inherit their parent's
+	// value unless they set their own.
+	MaxFlagColWidth int
+
+	// FlagGroups lists flags to be shown under their own headings in help.
+	// Flags not in any group are listed under the usual FlagsSectionLabel
+	// heading after the groups.
+	FlagGroups []FlagGroup
+
+	// OwnFlags optionally lists the flags of Flags that the command uses,
+	// for a command sharing a FlagSet with others of which it uses only
+	// some. Help, completion scripts, man pages and JSON then report only
+	// these flags, and any inherited through InheritFlags. All flags of the
+	// FlagSet are still accepted on the command line.
+	OwnFlags []string
+
+	// FlagOrder optionally lists flag names in the order they should appear
+	// in help. Flags not listed follow in alphabetical order. When empty,
+	// all flags are listed alphabetically. FlagGroups are ordered by their
+	// own Flags.
+	FlagOrder []string
+
+	// Examples are shown in help, below the flags and sub-commands, each
+	// as its command line followed by its description, wrapped and
+	// indented beneath it.
+	Examples []Example
+
+	// FlagPlaceholders maps flag names to the placeholder shown for the
+	// flag's value in help, e.g. FILE, in place of FlagTypeLabel.
+	FlagPlaceholders map[string]string
+
+	// FlagAliases maps the old names of renamed flags to their new names,
+	// so that the old names keep working. Each old name given on the
+	// command line is taken as the new one and reported as deprecated, as
+	// for DeprecatedFlags. Giving both names results in a FlagError. Old
+	// names are not shown in help.
+	FlagAliases map[string]string
+
+	// HideFlagTypeLabels omits the FlagTypeLabel that otherwise follows the
+	// name of each flag in help, e.g. showing -count rather than -count INT.
+	// Placeholders from FlagPlaceholders are still shown.
+	HideFlagTypeLabels bool
+
+	// UnknownHandler, when set, is called instead of returning an
+	// InvalidCommandError when the argument naming a sub-command matches
+	// none, with that argument and those following it, e.g. to run an
+	// external plugin as git runs git-foo for "git foo". An error it returns
+	// is wrapped in a RunError.
+	UnknownHandler func(name string, args []string) error
+
+	// CaptureRest makes ProcessArgs pass every argument following the
+	// command's name to it verbatim, without parsing any as flags or
+	// sub-commands, e.g. for "mytool exec ls -la /tmp". Its Flags may still
+	// be set from the environment or DefaultsFile.
+	CaptureRest bool
+
+	// PassUnknownFlags makes ProcessArgs pass flags that are not defined in
+	// Flags on instead of returning a FlagError, for commands that forward
+	// them to another program. Known flags are still parsed as usual. The
+	// unknown flags are placed ahead of the positional arguments passed to
+	// Run or, if the command has sub-commands, directly after the
+	// sub-command's name, or given to DefaultSubCommand if no name follows,
+	// where they are parsed as the sub-command's flags. Without a
+	// DefaultSubCommand, a command line with no sub-command name results in
+	// a MissingCommandError.
+	// As the values of unknown flags cannot be told from positional
+	// arguments, they must be given in the -flag=value form.
+	PassUnknownFlags bool
+
+	// DefaultSubCommand names the sub-command ProcessArgs dispatches to when
+	// no sub-command is given, instead of returning a MissingCommandError.
+	DefaultSubCommand string
+
+	// Version, when set on the root command, makes ProcessArgs recognize a
+	// -version flag, and a version sub-command if the root has sub-commands
+	// and none is named version. Either returns a VersionRequestedError.
+	Version string
+
+	// Style, when set, is the base for the refmt.Style used to wrap and
+	// indent each block of help. A copy is made for each block, with
+	// IndentWidth and MaxWidth set to suit it, so only its other properties
+	// take effect. Subcommands without their own Style inherit their
+	// parent's.
+	Style *refmt.Style
+
+	// HelpCache, when set, holds the command's rendered help for reuse, for
+	// each width, indent, coloring and set of flags, including inherited
+	// ones, it is rendered with. CacheHelp sets a HelpCache on every command
+	// in a tree. AddSubCommand empties the command's cache, but other
+	// changes that affect help, such as to its descriptions, the usage of
+	// its flags or the package-level settings, require InvalidateHelpCache.
+	HelpCache *HelpCache
+
+	// HelpTemplate, when set, replaces the built-in help layout. It is
+	// executed with the command's HelpData, and its output is used wherever
+	// the command's help is rendered. DefaultHelpTemplate is the built-in
+	// layout as a template, to start one's own from. If executing it fails,
+	// the error is written to Trace, if set, and the built-in layout is used
+	// instead. Subcommands without their own HelpTemplate inherit their
+	// parent's.
+	HelpTemplate *template.Template
+
+	// Output, when set, receives the command's help whenever ProcessArgs
+	// returns a usage error, and the error message is reduced to a short
+	// summary. When nil, the help is embedded in the error message.
+	// Subcommands without their own Output inherit their parent's.
+	Output io.Writer
+
+	// QuietErrors makes usage errors carry just their message, without the
+	// command's help, which is not written to Output either, for use from
+	// scripts. The help may still be rendered from the error's CommandType.
+	// Help that was asked for is shown as usual. Subcommands inherit
+	// QuietErrors from their parent.
+	QuietErrors bool
+
+	// InheritFlags makes the command's flags, including any it inherited
+	// itself, available to all of its descendants, so that global flags may
+	// be given either before or after a sub-command name. Each sub-command
+	// parses a copy of its own FlagSet extended with the inherited flags;
+	// the FlagSets themselves are not modified. Where a sub-command defines a
+	// flag with the same name as an inherited one, the sub-command's own
+	// definition wins, and the parent's flag can only be given before the
+	// sub-command name.
+	InheritFlags bool
+
+	// EnvPrefix and EnvVars let flags fall back to environment variables.
+	// After parsing, each flag not set on the command line is set from its
+	// environment variable, if present, so a flag given explicitly takes
+	// precedence over the environment, which takes precedence over
+	// DefaultsFile and the flag's default. EnvVars maps flag names to the
+	// variable to use; other flags use EnvPrefix, an underscore and the
+	// upper-cased flag name with dashes replaced by underscores, e.g.
+	// MYTOOL_TOKEN for -token. A bad value in the environment results in a
+	// FlagError. Subcommands without their own EnvPrefix inherit their
+	// parent's.
+	EnvPrefix string
+	EnvVars   map[string]string
+
+	// DefaultsFile names a file of flag values loaded before the command
+	// line is parsed, so that users can keep persistent defaults. The file
+	// is either a JSON object or lines of name=value, where blank lines and
+	// lines starting with # are ignored. JSON arrays set a flag once for
+	// each element. Names that are not flags of the command, which include
+	// the help and version flags added by ProcessArgs, are ignored unless
+	// StrictDefaultsFile is set, in which case they, like bad values, result
+	// in a FlagError. A missing file is not an error. Values from the file
+	// are overridden by the environment and by the command line.
+	DefaultsFile       string
+	StrictDefaultsFile bool
+
+	// Deprecated, when set, marks the command as deprecated. It still runs,
+	// but ProcessArgs reports a notice including this message, and the
+	// command is marked "(deprecated)" in its parent's help.
+	Deprecated string
+
+	// DeprecatedFlags maps the names of deprecated flags to a message, such
+	// as the flag to use instead. Setting one on the command line reports a
+	// notice, and the flag is marked "(deprecated)" in help.
+	DeprecatedFlags map[string]string
+
+	// Trace, when set, receives a log of how ProcessArgs resolves the
+	// command line: the arguments each command is given, the flags it set,
+	// the sub-command matched and any error. Subcommands without their own
+	// Trace inherit their parent's.
+	Trace io.Writer
+
+	// DeprecationOutput, when set, receives a line for each deprecation
+	// notice. Notices are also collected in Result.Deprecations.
+	// Subcommands without their own DeprecationOutput inherit their
+	// parent's.
+	DeprecationOutput io.Writer
+
+	inherited  []string          // names of flags inherited from the parent
+	shortFlags map[string]string // short names of flags, set by AliasFlag
+}
+
+// A FlagGroup is a titled set of flags shown together in help.
+type FlagGroup struct {
+	Title string   // heading shown above the flags
+	Flags []string // names of flags in the group
+}
+
+// An Example is a sample invocation of a command shown in its help.
+type Example struct {
+	Command     string // the command line, e.g. "mytool deploy app 1.2"
+	Description string // what the command line does
+}
+
+// A SubCommandGroup is a titled set of sub-commands shown together in help.
+type SubCommandGroup struct {
+	Title    string   // heading shown above the sub-commands
+	Commands []string // names of sub-commands in the group, in order
 }
 
 // NewCommandType returns an initialized CommandType
@@ -40,23 +433,56 @@ func NewCommandType(name string, flags *flag.FlagSet) CommandType {
 	return c
 }
 
-// The Error interface implements error and adds CommandType() and Args()
-// methods that return the CommandType object in which the error occurred and
-// the remaining arguments that were being process when the error occurred,
-// respectively
+// String returns a one-line summary of the command for debugging, e.g.
+// "CommandType{name=deploy, flags=5, subcommands=[destroy status]}", with the
+// sub-commands in alphabetical order.
+func (c CommandType) String() string {
+	flags := 0
+	c.allFlags(func(*flag.Flag) { flags++ })
+	names := make([]string, 0, len(c.SubCommands))
+	for n := range c.SubCommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("CommandType{name=%s, flags=%d, subcommands=[%s]}", c.Name, flags, strings.Join(names, " "))
+}
+
+// AddSubCommand adds sub to c's SubCommands under sub.Name, replacing any
+// sub-command of that name, and returns c so that calls can be chained.
+// Since SubCommands holds copies, sub should be fully configured, including
+// its own sub-commands, before it is added.
+func (c *CommandType) AddSubCommand(sub CommandType) *CommandType {
+	if c.SubCommands == nil {
+		c.SubCommands = map[string]CommandType{}
+	}
+	c.SubCommands[sub.Name] = sub
+	if c.HelpCache != nil {
+		c.HelpCache.Invalidate()
+	}
+	return c
+}
+
+// The Error interface implements error and adds CommandType(), Args() and
+// Path() methods that return the CommandType object in which the error
+// occurred, the remaining arguments that were being process when the error
+// occurred, and the names of the commands from the root to the one in which
+// the error occurred, respectively
 type Error interface {
 	Error() string             // standard error interface
 	CommandType() *CommandType // reference to command type that had error
 	Args() []string            // slice of remaining arguments
+	Path() []string            // command names from root to failing command
 }
 
 // A UsageError object is defined as the underlying type for the
-// MissingCommandError, InvalidCommandError, and FlagError types. It
-// implements the Error interface.
+// MissingCommandError, InvalidCommandError, FlagError, ArgCountError and
+// RunError types. It implements the Error interface.
 type UsageError struct {
 	e string       // error message
+	m string       // error message without the help, if it differs from e
 	c *CommandType // reference to the offended CommandType
 	a []string     // the args that offended the CommandType
+	p []string     // names of commands from the root to the CommandType
 }
 
 // Error implements the standard error interface in UsageError.
@@ -69,6 +495,10 @@ func (e UsageError) CommandType() *CommandType { return e.c }
 // Args returns the arguments being process when the error was encountered.
 func (e UsageError) Args() []string { return e.a }
 
+// Path returns the names of the commands from the root to the one that
+// encountered the error.
+func (e UsageError) Path() []string { return e.p }
+
 // A MissingCommandError is returned when a command expected a sub-command
 // (i.e. the CommandType object's SubCommands map was not empty) but there
 // were no more arguments remaining to process.
@@ -78,148 +508,1690 @@ type MissingCommandError struct {
 
 // An InvalidCommandError is returned when a command expected a sub-command,
 // but the next remaining argument does not match the valid sub-commands in
-// the CommandType object's SubCommands map.
+// the CommandType object's SubCommands map, including when it is a flag the
+// command does not define.
 type InvalidCommandError struct {
 	UsageError
 }
 
 // A FlagError is returned when the upstream flag library encounters an error
-// while parsing arguments for flags.
+// while parsing arguments for flags, or the flags fail a check such as
+// RequiredFlags.
 type FlagError struct {
 	UsageError
+	err error // error from the flag library or ValidateFlags, if any
+}
+
+// Unwrap returns the error from the flag library, ValidateFlags, the
+// environment or DefaultsFile that caused the FlagError, or nil if the flags
+// failed one of the checks of RequiredFlags or MutuallyExclusive.
+func (e FlagError) Unwrap() error { return e.err }
+
+// An ArgCountError is returned when a command without sub-commands receives
+// fewer than MinArgs or more than MaxArgs positional arguments.
+type ArgCountError struct {
+	UsageError
+}
+
+// A VersionRequestedError is returned when the version of the root command
+// was requested with -version or the version sub-command. Its message is the
+// version string, which is also written to Output if set. It is not a
+// failure; callers should print the message and exit successfully.
+type VersionRequestedError struct {
+	UsageError
+}
+
+// A HelpRequestedError is returned when help was requested with the
+// HelpCommandName sub-command or one of the HelpFlagNames flags. Its message
+// is the rendered help of the target command, unless Output is set, in which
+// case the help is written there instead. It is not a failure; callers should
+// print the message and exit successfully.
+type HelpRequestedError struct {
+	UsageError
+}
+
+// A RunError is returned when the Run or RunContext handler of the resolved
+// command returns an error. Unlike the other error types it does not indicate
+// a usage problem, so callers can distinguish runtime failures from bad
+// arguments.
+type RunError struct {
+	UsageError
+	err error // error returned by Run
+}
+
+// Unwrap returns the error returned by the Run handler.
+func (e RunError) Unwrap() error { return e.err }
+
+// Sentinel errors matched by the error types with errors.Is, so that
+//
+//	errors.Is(err, commandflags.ErrInvalidCommand)
+//
+// may be used in place of a type switch.
+var (
+	ErrMissingCommand   = errors.New("missing command")
+	ErrInvalidCommand   = errors.New("invalid command")
+	ErrFlag             = errors.New("flag error")
+	ErrArgCount         = errors.New("wrong number of arguments")
+	ErrVersionRequested = errors.New("version requested")
+	ErrHelpRequested    = errors.New("help requested")
+	ErrRun              = errors.New("run failed")
+)
+
+// Is reports whether target is ErrMissingCommand.
+func (e MissingCommandError) Is(target error) bool { return target == ErrMissingCommand }
+
+// Is reports whether target is ErrInvalidCommand.
+func (e InvalidCommandError) Is(target error) bool { return target == ErrInvalidCommand }
+
+// Is reports whether target is ErrFlag.
+func (e FlagError) Is(target error) bool { return target == ErrFlag }
+
+// Is reports whether target is ErrArgCount.
+func (e ArgCountError) Is(target error) bool { return target == ErrArgCount }
+
+// Is reports whether target is ErrVersionRequested.
+func (e VersionRequestedError) Is(target error) bool { return target == ErrVersionRequested }
+
+// Is reports whether target is ErrHelpRequested.
+func (e HelpRequestedError) Is(target error) bool { return target == ErrHelpRequested }
+
+// Is reports whether target is ErrRun.
+func (e RunError) Is(target error) bool { return target == ErrRun }
+
+// ExitCode returns the conventional exit status for err: 0 for no error or a
+// request for version or help, 1 for a RunError, and 2, as the flag package
+// uses, for a usage error such as a bad flag or a missing or invalid
+// command.
+func ExitCode(err Error) int {
+	switch err.(type) {
+	case nil, VersionRequestedError, HelpRequestedError:
+		return 0
+	case RunError:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Main processes args, typically os.Args[1:], as with ProcessArgs, reports
+// the outcome and returns the exit status from ExitCode, so that a program's
+// main function can be just:
+//
+//	os.Exit(cmd.Main(os.Args[1:]))
+//
+// Requested version and help are written to standard output, unless they
+// were already written to the command's Output, and other errors to
+// standard error.
+func (c *CommandType) Main(args []string) int {
+	_, err := c.ProcessArgs(args)
+	if err == nil {
+		return 0
+	}
+	msg := strings.TrimRight(err.Error(), "\n")
+	written := err.CommandType() != nil && err.CommandType().Output != nil
+	switch err.(type) {
+	case VersionRequestedError, HelpRequestedError:
+		if !written {
+			fmt.Fprintln(os.Stdout, msg)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	return ExitCode(err)
 }
 
 // ProcessArgs starts the recursive process of setting flags and processing
 // sub-commands and returns a slice of strings that correspond to the names of
-// the commands/subcommands chosen.
+// the commands/subcommands chosen. If the resolved command has a Run handler,
+// it is called with the remaining arguments and any error it returns is
+// wrapped in a RunError.
 func (c *CommandType) ProcessArgs(args []string) ([]string, Error) {
-	// reconfigure flags' error handling:
-	f := func() {} // noop function
+	return c.ProcessArgsContext(context.Background(), args)
+}
+
+// ProcessArgsContext is like ProcessArgs but passes ctx to the RunContext
+// handler of the resolved command, so that long running handlers can be
+// cancelled.
+func (c *CommandType) ProcessArgsContext(ctx context.Context, args []string) ([]string, Error) {
+	return c.process(&state{ctx: ctx, res: &Result{}}, nil, args)
+}
+
+// Result describes the outcome of processing a command line.
+type Result struct {
+	Path    []string     // names of the commands resolved, starting with the root
+	Command *CommandType // the command the arguments resolved to
+	Args    []string     // positional arguments left for Command
+
+	// Flags holds, for each command in Path, the flags explicitly set on the
+	// command line mapped to their values.
+	Flags []map[string]string
+
+	// Sources holds, for each command in Path, where each of its flags got
+	// its value from.
+	Sources []map[string]FlagSource
+
+	// Deprecations holds a notice for each deprecated command or flag used.
+	Deprecations []string
+}
+
+// A FlagSource tells where a flag's value came from.
+type FlagSource int
+
+// The sources of flag values, from lowest to highest precedence.
+const (
+	SourceDefault     FlagSource = iota // the flag's default value
+	SourceFile                          // DefaultsFile
+	SourceEnv                           // an environment variable
+	SourceCommandLine                   // the command line
+)
+
+// String returns a lower-case name for the source, e.g. "command line".
+func (s FlagSource) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceFile:
+		return "file"
+	case SourceEnv:
+		return "env"
+	case SourceCommandLine:
+		return "command line"
+	}
+	return "FlagSource(" + strconv.Itoa(int(s)) + ")"
+}
+
+// CommandPath returns the names of the resolved commands joined by spaces,
+// e.g. "example deployments status".
+func (r *Result) CommandPath() string { return strings.Join(r.Path, " ") }
+
+// PositionalArgs returns the arguments following the command path, which are
+// those passed to the resolved command's Run handler.
+func (r *Result) PositionalArgs() []string { return r.Args }
+
+// Process is like ProcessArgs but returns a Result describing the resolved
+// command. When an error is returned, the Result describes how far processing
+// got before it failed.
+func (c *CommandType) Process(args []string) (*Result, Error) {
+	return c.ProcessContext(context.Background(), args)
+}
+
+// ProcessContext is like Process but passes ctx to the RunContext handler of
+// the resolved command.
+func (c *CommandType) ProcessContext(ctx context.Context, args []string) (*Result, Error) {
+	st := &state{ctx: ctx, res: &Result{}}
+	_, err := c.process(st, nil, args)
+	return st.res, err
+}
+
+// Resolve is like Process but returns just the command the arguments
+// resolved to and the positional arguments left for it. The command is the
+// sub-command as processed, with any settings inherited from its parents
+// applied, so its fields, such as Flags, may be read by the caller's own
+// dispatch code. When an error is returned, the command is the one that was
+// being processed when it occurred, as returned by the error's CommandType
+// method.
+func (c *CommandType) Resolve(args []string) (*CommandType, []string, Error) {
+	r, err := c.Process(args)
+	if err != nil {
+		return err.CommandType(), r.Args, err
+	}
+	return r.Command, r.Args, err
+}
+
+// state is carried through the recursion of process.
+type state struct {
+	ctx      context.Context
+	res      *Result
+	reset    map[flag.Value]bool       // flag values already reset by resetFlags
+	set      map[flag.Value]FlagSource // where flag values were set from
+	expanded bool                      // whether response files have been expanded
+}
+
+// give records in st.set the source of the value of each flag in fs not left
+// at its default according to sources, so that commands further down the
+// command line, which may share the value, neither reset it nor set it again
+// from a source of lower or equal precedence.
+func (st *state) give(fs *flag.FlagSet, sources map[string]FlagSource) {
+	if st.set == nil {
+		st.set = map[flag.Value]FlagSource{}
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if src := sources[f.Name]; src > setFrom(f, st.set) {
+			st.set[f.Value] = src
+		}
+	})
+}
+
+// record adds c, reached by path, to the result, where sources holds the
+// source of each flag that was not left at its default.
+func (st *state) record(c *CommandType, path []string, sources map[string]FlagSource) {
+	set := map[string]string{}
+	all := map[string]FlagSource{}
+	c.allFlags(func(f *flag.Flag) {
+		if isBuiltinFlag(f) {
+			return
+		}
+		if sources[f.Name] == SourceCommandLine {
+			set[f.Name] = f.Value.String()
+		}
+		all[f.Name] = sources[f.Name]
+	})
+	st.res.Path = path
+	st.res.Command = c
+	st.res.Args = nil
+	st.res.Flags = append(st.res.Flags, set)
+	st.res.Sources = append(st.res.Sources, all)
+
+	if c.Deprecated != "" {
+		st.deprecated(c, fmt.Sprintf(MsgCommandDeprecated, c.Name, c.Deprecated))
+	}
+	c.Flags.Visit(func(f *flag.Flag) {
+		msg, ok := c.DeprecatedFlags[f.Name]
+		ok = ok && sources[f.Name] == SourceCommandLine
+		switch {
+		case !ok:
+		case msg == "":
+			st.deprecated(c, fmt.Sprintf(MsgFlagDeprecated, f.Name))
+		default:
+			st.deprecated(c, fmt.Sprintf(MsgFlagDeprecatedBecause, f.Name, msg))
+		}
+	})
+}
+
+// deprecated records the deprecation notice msg for c.
+func (st *state) deprecated(c *CommandType, msg string) {
+	st.res.Deprecations = append(st.res.Deprecations, msg)
+	if c.DeprecationOutput != nil {
+		fmt.Fprintln(c.DeprecationOutput, msg)
+	}
+}
+
+// process implements ProcessArgsContext for c, where parent holds the names
+// of the commands already resolved above c.
+func (c *CommandType) process(st *state, parent []string, args []string) (words []string, err Error) {
+	path := append(parent[:len(parent):len(parent)], c.Name)
+	c.tracef(path, "processing %q", args)
+	defer func() {
+		if err != nil && len(err.Path()) == len(path) {
+			c.tracef(path, "%T: %s", err, strings.SplitN(err.Error(), "\n", 2)[0])
+		}
+	}()
+	if err := tooDeep(path); err != nil {
+		return path, InvalidCommandError{
+			UsageError: UsageError{e: err.Error(), c: c, a: args, p: path},
+		}
+	}
 
-	// ensure Flags is set
+	// a command without a flagset takes no flags
 	if c.Flags == nil {
-		c.Flags = &flag.FlagSet{}
+		c.Flags = flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	}
+
+	// parse a copy of the flagset, so that the help and version flags are
+	// not left defined in the caller's
+	defer func(fs *flag.FlagSet) { c.Flags = fs }(c.Flags)
+	c.Flags = copyFlagSet(c.Name, c.Flags)
+	if parent == nil && c.Version != "" {
+		c.addVersionFlag()
+	}
+	c.addHelpFlags()
+
+	// undo any earlier parse of a shared or reused flagset, but not of the
+	// flags an ancestor has already parsed, whether through a shared
+	// flagset or InheritFlags, whose values were set on the command line
+	// before this command's name
+	if st.reset == nil {
+		st.reset = map[flag.Value]bool{}
+	}
+	resetFlags(c.Flags, st.reset)
+
+	// replace @file arguments with the file's contents
+	if c.ExpandResponseFiles && !st.expanded {
+		expanded, err := expandResponseFiles(args)
+		if err != nil {
+			return path, FlagError{
+				UsageError: c.usageError(err.Error(), path, args),
+				err:        err,
+			}
+		}
+		args, st.expanded = expanded, true
+	}
+
+	// sources collects where each flag not left at its default was set from
+	sources := map[string]FlagSource{}
+
+	// load defaults for the flags, which the command line may override
+	if err := c.applyDefaultsFile(sources, st.set); err != nil {
+		return path, FlagError{
+			UsageError: c.usageError(err.Error(), path, args),
+			err:        err,
+		}
+	}
+
+	// set aside flags c does not know, if it passes them on, or all of
+	// args, if c captures them
+	var unknown []string
+	parsed := args
+	if c.NormalizeFlagName != nil {
+		parsed = normalizeFlags(c.Flags, parsed, c.NormalizeFlagName)
+	}
+	if len(c.FlagAliases) > 0 && !c.CaptureRest {
+		var renamed []string
+		var err error
+		if parsed, renamed, err = renameFlags(c.Flags, parsed, c.FlagAliases); err != nil {
+			return path, FlagError{
+				UsageError: c.usageError(err.Error(), path, args),
+				err:        err,
+			}
+		}
+		for _, old := range renamed {
+			st.deprecated(c, fmt.Sprintf(MsgFlagRenamed, old, c.FlagAliases[old]))
+		}
+	}
+	if c.AllowBundledShortFlags && !c.CaptureRest {
+		var err error
+		if parsed, err = expandBundledFlags(c.Flags, parsed); err != nil {
+			return path, FlagError{
+				UsageError: c.usageError(err.Error(), path, args),
+				err:        err,
+			}
+		}
+	}
+	switch {
+	case c.CaptureRest:
+		parsed = nil
+	case c.PassUnknownFlags:
+		parsed, unknown = splitUnknownFlags(c.Flags, parsed)
 	}
 
-	c.Flags.Init(c.Name, flag.ContinueOnError)
-	c.Flags.Usage = f
+	// an undefined flag where a sub-command name is expected, with no name
+	// after it, is reported as such rather than as a bad flag
+	if len(c.SubCommands) > 0 && !c.CaptureRest && !c.PassUnknownFlags {
+		known, undefined := splitUnknownFlags(c.Flags, parsed)
+		if n, terminated := scanFlags(c.Flags, known); len(undefined) > 0 && n == len(known) && !terminated {
+			return path, InvalidCommandError{
+				UsageError: c.usageError(fmt.Sprintf(MsgFlagNotCommand, undefined[0]), path, args),
+			}
+		}
+	}
 
 	// Parse the command line for global opts
-	if err := c.Flags.Parse(args); err != nil {
-		return []string{c.Name}, FlagError{
-			UsageError: UsageError{
-				//e: err.Error(),
-				e: fmt.Sprintf("%s", c.renderHelp(DefaultWidth)),
-				c: c,
-				a: args,
-			},
+	if err := c.parseFlags(parsed); err != nil {
+		return path, FlagError{
+			UsageError: c.usageError(err.Error(), path, args),
+			err:        err,
+		}
+	}
+	if c.helpFlagSet() {
+		return path, c.helpRequested(path, args)
+	}
+	if c.versionFlagSet() {
+		return path, c.versionRequested(path, args)
+	}
+	for name := range commandLineFlags(c.Flags, parsed) {
+		sources[name] = SourceCommandLine
+	}
+	for long, short := range c.shortFlags {
+		if sources[short] == SourceCommandLine {
+			sources[long] = SourceCommandLine
+		}
+	}
+
+	// fall back to the environment for flags not on the command line, and
+	// not already set, here or by an ancestor sharing the flag's value
+	if err := c.applyEnv(sources, st.set); err != nil {
+		return path, FlagError{
+			UsageError: c.usageError(err.Error(), path, args),
+			err:        err,
 		}
 	}
+	st.give(c.Flags, sources)
+	st.record(c, path, sources)
+
+	// ensure required flags were provided
+	if missing := c.missingFlags(sources); len(missing) > 0 {
+		return path, FlagError{
+			UsageError: c.usageError(fmt.Sprintf(MsgMissingFlags, strings.Join(missing, ", ")), path, args),
+		}
+	}
+
+	// ensure mutually exclusive flags were not combined
+	if conflicts := c.conflictingFlags(sources); len(conflicts) > 0 {
+		return path, FlagError{
+			UsageError: c.usageError(fmt.Sprintf(MsgConflictingFlags, strings.Join(conflicts, "; ")), path, args),
+		}
+	}
+
+	// let the command check its flags' values
+	if c.ValidateFlags != nil {
+		if err := c.ValidateFlags(); err != nil {
+			return path, FlagError{
+				UsageError: c.usageError(err.Error(), path, args),
+				err:        err,
+			}
+		}
+	}
+
 	// remaining arguments after processing flag group
 	remaining := c.Flags.Args()
+	c.traceFlags(path, sources)
+
+	// Arguments following a "--" are passed verbatim to this command, even
+	// if it has sub-commands, so that they are never parsed as flags or
+	// sub-commands further down.
+	_, terminated := scanFlags(c.Flags, parsed)
+	if c.CaptureRest {
+		remaining, terminated = args, true
+	}
+
+	// unknown flags go to the command's handler, or to the sub-command,
+	// which, if none is named, is the default sub-command
+	switch {
+	case len(unknown) == 0:
+	case len(c.SubCommands) == 0 || terminated:
+		remaining = append(unknown, remaining...)
+	case len(remaining) > 0:
+		remaining = append(append(remaining[:1:1], unknown...), remaining[1:]...)
+	}
+
+	c.tracef(path, "remaining arguments %q", remaining)
 
-	// If subcommands are defined, then recurse. Otherwise run func()
-	if len(c.SubCommands) == 0 {
-		return append([]string{c.Name}, remaining...), nil
+	// If subcommands are defined, then recurse. Otherwise call Run
+	if len(c.SubCommands) == 0 || terminated {
+		st.res.Args = remaining
+		if !c.argCountOK(len(remaining)) {
+			return path, ArgCountError{
+				UsageError: c.usageError(c.argCountMessage(len(remaining)), path, args),
+			}
+		}
+		c.tracef(path, "resolved with arguments %q", remaining)
+		if err := c.run(st.ctx, remaining); err != nil {
+			return append(path, remaining...), RunError{
+				UsageError: UsageError{
+					e: err.Error(),
+					c: c,
+					a: remaining,
+					p: path,
+				},
+				err: err,
+			}
+		}
+		return append(path, remaining...), nil
 	}
 	if len(remaining) == 0 {
-		return []string{c.Name}, MissingCommandError{
-			UsageError: UsageError{
-				e: fmt.Sprintf("Missing COMMAND:\n%s", c.renderHelp(DefaultWidth)),
-				c: c,
-				a: args,
-			},
+		if sc, ok := c.lookupSubCommand(c.DefaultSubCommand); ok && c.DefaultSubCommand != "" {
+			c.tracef(path, "no sub-command given, using default %q", sc.Name)
+			sc.inherit(c)
+			return sc.process(st, path, unknown)
+		}
+		return path, MissingCommandError{
+			UsageError: c.usageError(MsgMissingCommand, path, args),
+		}
+	}
+	// a token that looks like a flag, such as "-", never names a sub-command
+	if strings.HasPrefix(remaining[0], "-") {
+		return path, InvalidCommandError{
+			UsageError: c.usageError(fmt.Sprintf(MsgFlagNotCommand, remaining[0]), path, args),
+		}
+	}
+	sc, ok := c.lookupSubCommand(remaining[0])
+	if !ok && parent == nil && c.Version != "" && remaining[0] == "version" {
+		return path, c.versionRequested(path, args)
+	}
+	if !ok && c.UnknownHandler != nil {
+		c.tracef(path, "%q passed to UnknownHandler", remaining[0])
+		st.res.Args = remaining
+		if err := c.UnknownHandler(remaining[0], remaining[1:]); err != nil {
+			return append(path, remaining...), RunError{
+				UsageError: UsageError{e: err.Error(), c: c, a: remaining, p: path},
+				err:        err,
+			}
 		}
+		return append(path, remaining...), nil
 	}
-	sc, ok := c.SubCommands[remaining[0]]
 	if !ok {
-		return []string{c.Name}, InvalidCommandError{
-			UsageError: UsageError{
-				e: fmt.Sprintf("Invalid COMMAND: %s\n%s", remaining[0], c.renderHelp(DefaultWidth)),
-				c: c,
-				a: args,
-			},
+		return path, InvalidCommandError{
+			UsageError: c.usageError(c.invalidCommand(path, remaining[0]), path, args),
 		}
 	}
-	cp, err := sc.ProcessArgs(remaining[1:])
-	return append([]string{c.Name}, cp...), err
+	c.tracef(path, "%q matched sub-command %q", remaining[0], sc.Name)
+	sc.inherit(c)
+	if sc.Name == HelpCommandName {
+		return c.helpFor(path, remaining[1:])
+	}
+	return sc.process(st, path, remaining[1:])
 }
 
-func (c CommandType) renderHelp(width int) string {
-	style := refmt.NewStyle()
-	style.IndentWidth = HelpIndent
-	style.MaxWidth = width - HelpIndent
-	help := fmt.Sprintf("Command: %s\n", c.Name)
+// tracef writes a line to Trace, if set, about processing the command at
+// path.
+func (c *CommandType) tracef(path []string, format string, a ...interface{}) {
+	if c.Trace != nil {
+		fmt.Fprintf(c.Trace, "%s: %s\n", strings.Join(path, " "), fmt.Sprintf(format, a...))
+	}
+}
 
-	// Print description, if set -- prefer LongDesc
-	switch {
-	case len(c.LongDesc) > 0:
-		help += fmt.Sprintf("%s\n\n", style.Indent(style.Wrap(c.LongDesc)))
-	case len(c.ShortDesc) > 0:
-		help += fmt.Sprintf("%s\n\n", style.Indent(style.Wrap(c.ShortDesc)))
+// traceFlags traces the values of the flags of the command at path that were
+// not left at their defaults, and where they came from.
+func (c *CommandType) traceFlags(path []string, sources map[string]FlagSource) {
+	if c.Trace == nil {
+		return
+	}
+	set := []string{}
+	c.allFlags(func(f *flag.Flag) {
+		if src := sources[f.Name]; src != SourceDefault && !isBuiltinFlag(f) {
+			set = append(set, fmt.Sprintf("-%s=%s (%s)", f.Name, f.Value, src))
+		}
+	})
+	if len(set) == 0 {
+		c.tracef(path, "no flags set")
+		return
 	}
+	c.tracef(path, "flags set: %s", strings.Join(set, ", "))
+}
 
-	// obtain the flags in the flagset and generate labels
-	flags := []*flag.Flag{}
-	flagArgs := map[string]string{}
-	maxFlagWidth := 0
-	appendFlag := func(f *flag.Flag) {
-		flags = append(flags, f)
-		label := ""
-		// Thank frobnitz for figuring this out
-		switch f.Value.(flag.Getter).Get().(type) {
-		case bool:
-			label = ""
-		case uint64, uint:
-			label = "UINT"
-		case int64, int:
-			label = "INT"
-		case string:
-			label = "STRING"
-		case float64:
-			label = "FLOAT"
-		default:
-			label = "VALUE"
+// tooDeep returns an error if path is longer than MaxDepth.
+func tooDeep(path []string) error {
+	if len(path) > MaxDepth {
+		return fmt.Errorf(MsgTooDeep, strings.Join(path, " "), MaxDepth)
+	}
+	return nil
+}
+
+// helpFor resolves names as a path of sub-commands below c, whose own path is
+// path, and returns a HelpRequestedError for the command found.
+func (c *CommandType) helpFor(path, names []string) ([]string, Error) {
+	target := *c
+	for i, n := range names {
+		sc, ok := target.lookupSubCommand(n)
+		if !ok {
+			return path, InvalidCommandError{
+				UsageError: target.usageError(target.invalidCommand(path, n), path, names[i:]),
+			}
 		}
-		flagArgs[f.Name] = label
-		if len(f.Name)+len(label) > maxFlagWidth {
-			maxFlagWidth = len(f.Name) + len(label)
+		sc.inherit(&target)
+		target = sc
+		path = append(path[:len(path):len(path)], sc.Name)
+	}
+	return path, target.helpRequested(path, names)
+}
+
+// helpRequested returns a HelpRequestedError for c.
+func (c *CommandType) helpRequested(path, args []string) HelpRequestedError {
+	help := c.renderHelp(c.helpWidth())
+	if c.Output != nil {
+		fmt.Fprint(c.Output, help)
+		help = MsgHelpRequested
+	}
+	return HelpRequestedError{
+		UsageError: UsageError{e: help, m: MsgHelpRequested, c: c, a: args, p: path},
+	}
+}
+
+// helpFlag is the type of the help flags added by ProcessArgs, which
+// distinguishes them from user defined flags of the same names.
+type helpFlag bool
+
+func (v *helpFlag) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *helpFlag) Get() interface{} { return bool(*v) }
+func (v *helpFlag) IsBoolFlag() bool { return true }
+func (v *helpFlag) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	*v = helpFlag(b)
+	return err
+}
+
+// addHelpFlags defines a flag in Flags for each of HelpFlagNames unless a
+// flag of that name already exists.
+func (c *CommandType) addHelpFlags() {
+	for _, name := range HelpFlagNames {
+		if c.Flags.Lookup(name) == nil {
+			c.Flags.Var(new(helpFlag), name, MsgHelpFlagUsage)
 		}
 	}
-	c.Flags.VisitAll(appendFlag)
+}
+
+// helpFlagSet reports whether any help flag added by addHelpFlags was given.
+func (c *CommandType) helpFlagSet() bool {
+	set := false
+	c.Flags.VisitAll(func(f *flag.Flag) {
+		if v, ok := f.Value.(*helpFlag); ok && bool(*v) {
+			set = true
+		}
+	})
+	return set
+}
 
-	// set width needed to express flagnames
-	flagColWidth := maxFlagWidth + 6 // 4 = 2 for left indent, 1 for dash, 1 for space between name and label, 2 for space at end
+// versionFlag is the type of the -version flag added by ProcessArgs, which
+// distinguishes it from a user defined flag of the same name.
+type versionFlag bool
 
-	// print help for flags
-	flagStyle := refmt.NewStyle()
-	flagStyle.MaxWidth = width - flagColWidth
-	flagStyle.IndentWidth = flagColWidth
-	if len(flags) > 0 {
-		help += fmt.Sprintf("%*s%s flags:\n", HelpIndent, "", c.Name)
+func (v *versionFlag) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *versionFlag) Get() interface{} { return bool(*v) }
+func (v *versionFlag) IsBoolFlag() bool { return true }
+func (v *versionFlag) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	*v = versionFlag(b)
+	return err
+}
+
+// addVersionFlag defines the -version flag in Flags unless a flag of that
+// name already exists.
+func (c *CommandType) addVersionFlag() {
+	if c.Flags.Lookup("version") == nil {
+		c.Flags.Var(new(versionFlag), "version", MsgVersionFlagUsage)
 	}
-	for _, f := range flags {
-		flag := fmt.Sprintf("%*s-%s %s", HelpIndent, "", f.Name, flagArgs[f.Name])
-		help += fmt.Sprintf("%-*s%s\n", flagColWidth, flag, flagStyle.Indent2(flagStyle.Wrap(f.Usage)))
+}
+
+// versionFlagSet reports whether the -version flag added by addVersionFlag
+// was given.
+func (c *CommandType) versionFlagSet() bool {
+	if c.Flags.Lookup("version") == nil {
+		return false
 	}
+	v, ok := c.Flags.Lookup("version").Value.(*versionFlag)
+	return ok && bool(*v)
+}
 
-	// exit now if no subcommands
-	if len(c.SubCommands) < 1 {
-		return help
+// versionRequested returns a VersionRequestedError for c, writing the version
+// to Output if set.
+func (c *CommandType) versionRequested(path, args []string) VersionRequestedError {
+	if c.Output != nil {
+		fmt.Fprintln(c.Output, c.Version)
 	}
+	return VersionRequestedError{
+		UsageError: UsageError{e: c.Version, c: c, a: args, p: path},
+	}
+}
 
-	help += fmt.Sprintf("\n%*s%s sub-commands:\n", HelpIndent, "", c.Name)
-	maxSubcmdWidth := 0
-	for _, v := range c.SubCommands {
-		if len(v.Name) > maxSubcmdWidth {
-			maxSubcmdWidth = len(v.Name)
-		}
+// inherit copies the settings a subcommand shares with its parent p, unless
+// the subcommand sets its own.
+func (c *CommandType) inherit(p *CommandType) {
+	if c.Output == nil {
+		c.Output = p.Output
 	}
-	cmdStyle := refmt.NewStyle()
-	cmdStyle.MaxWidth = width - (HelpIndent + maxSubcmdWidth + 2)
-	cmdStyle.IndentWidth = HelpIndent + maxSubcmdWidth + 2
-	for _, v := range c.SubCommands {
-		help += fmt.Sprintf("%*s%-*s  %s\n", HelpIndent, "", maxSubcmdWidth, v.Name, cmdStyle.Indent2(cmdStyle.Wrap(v.ShortDesc)))
+	if c.Indent == 0 {
+		c.Indent = p.Indent
 	}
-	return help
+	if c.Width == 0 {
+		c.Width = p.Width
+	}
+	if c.MaxFlagColWidth == 0 {
+		c.MaxFlagColWidth = p.MaxFlagColWidth
+	}
+	if c.Style == nil {
+		c.Style = p.Style
+	}
+	if c.HelpTemplate == nil {
+		c.HelpTemplate = p.HelpTemplate
+	}
+	if c.Trace == nil {
+		c.Trace = p.Trace
+	}
+	if c.EnvPrefix == "" {
+		c.EnvPrefix = p.EnvPrefix
+	}
+	if c.DeprecationOutput == nil {
+		c.DeprecationOutput = p.DeprecationOutput
+	}
+	if p.QuietErrors {
+		c.QuietErrors = true
+	}
+	if c.NormalizeFlagName == nil {
+		c.NormalizeFlagName = p.NormalizeFlagName
+	}
+	if p.InheritFlags && p.Flags != nil {
+		c.inheritFlags(p.Flags)
+		c.InheritFlags = true
+	}
+}
+
+// inheritFlags replaces c.Flags with a copy that also defines the flags of
+// parent that c.Flags does not, other than the help and version flags added
+// by ProcessArgs.
+func (c *CommandType) inheritFlags(parent *flag.FlagSet) {
+	merged := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	define := func(f *flag.Flag) {
+		merged.Var(f.Value, f.Name, f.Usage)
+		merged.Lookup(f.Name).DefValue = f.DefValue
+	}
+	c.allFlags(define)
+	c.inherited = nil
+	parent.VisitAll(func(f *flag.Flag) {
+		if merged.Lookup(f.Name) == nil && !isBuiltinFlag(f) {
+			define(f)
+			c.inherited = append(c.inherited, f.Name)
+		}
+	})
+	c.Flags = merged
+}
+
+// run calls the command's RunContext or Run handler, if either is set.
+func (c *CommandType) run(ctx context.Context, args []string) error {
+	switch {
+	case c.RunContext != nil:
+		return c.RunContext(ctx, args)
+	case c.Run != nil:
+		return c.Run(args)
+	}
+	return nil
+}
+
+// RenderHelp returns the formatted help for the command, wrapped to width
+// columns. This is the same text that is embedded in usage errors returned by
+// ProcessArgs.
+func (c CommandType) RenderHelp(width int) string {
+	return c.render(width, colorEnabled(nil))
+}
+
+// render implements RenderHelp, coloring the help if color is true.
+func (c CommandType) render(width int, color bool) string {
+	if c.HelpCache == nil {
+		return c.renderUncached(width, color)
+	}
+	var flags []string
+	c.visitFlags(func(f *flag.Flag) { flags = append(flags, f.Name) })
+	k := helpKey{
+		width:    width,
+		indent:   c.helpIndent(),
+		color:    color,
+		flags:    strings.Join(flags, " "),
+		colWidth: c.MaxFlagColWidth,
+		style:    c.Style,
+		tmpl:     c.HelpTemplate,
+	}
+	if help, ok := c.HelpCache.get(k); ok {
+		return help
+	}
+	help := c.renderUncached(width, color)
+	c.HelpCache.put(k, help)
+	return help
+}
+
+// renderUncached implements render without HelpCache.
+func (c CommandType) renderUncached(width int, color bool) string {
+	if c.HelpTemplate != nil {
+		help, err := c.renderTemplate(width)
+		if err == nil {
+			return help
+		}
+		if c.Trace != nil {
+			fmt.Fprintf(c.Trace, "%s: help template: %v\n", c.Name, err)
+		}
+	}
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	indent := c.helpIndent()
+	style := c.newStyle()
+	style.IndentWidth = indent
+	style.MaxWidth = wrapWidth(width, indent)
+	help := ""
+	if HelpHeaderFormat != "" {
+		help = fmt.Sprintf(HelpHeaderFormat, paint(colorCommand, c.Name))
+	}
+	if ShowTagline && len(c.LongDesc) > 0 && len(c.ShortDesc) > 0 {
+		help += fmt.Sprintf("%s\n\n", style.Indent(style.Wrap(c.ShortDesc)))
+	}
+	if ShowSynopsis {
+		help += fmt.Sprintf("%*s%s\n\n", indent, "", fmt.Sprintf(MsgSynopsis, c.Synopsis()))
+	}
+
+	// Print description, if set -- prefer LongDesc
+	switch {
+	case len(c.LongDesc) > 0:
+		help += fmt.Sprintf("%s\n\n", style.Indent(style.Wrap(c.LongDesc)))
+	case len(c.ShortDesc) > 0:
+		help += fmt.Sprintf("%s\n\n", style.Indent(style.Wrap(c.ShortDesc)))
+	}
+
+	flags, flagNames, flagCols, flagColWidth := c.flagColumns()
+
+	// print help for flags
+	flagStyle := c.newStyle()
+	flagStyle.MaxWidth = wrapWidth(width, flagColWidth)
+	flagStyle.IndentWidth = flagColWidth
+	for i, g := range c.flagSections(flags) {
+		if i > 0 {
+			help += "\n"
+		}
+		help += fmt.Sprintf("%*s%s\n", indent, "", paint(colorHeader, g.title))
+		for _, f := range g.flags {
+			flag := fmt.Sprintf("%-*s", flagColWidth, flagCols[f.Name])
+			flag = strings.Replace(flag, flagNames[f.Name], paint(colorFlag, flagNames[f.Name]), 1)
+			if c.flagColTooWide(utf8.RuneCountInString(flagCols[f.Name])) {
+				// the usage goes on the lines below
+				help += fmt.Sprintf("%s\n%s\n", strings.TrimRight(flag, " "), flagStyle.Indent(flagStyle.Wrap(c.flagUsage(f))))
+				continue
+			}
+			help += fmt.Sprintf("%s%s\n", flag, flagStyle.Indent2(flagStyle.Wrap(c.flagUsage(f))))
+		}
+	}
+
+	// print the visible subcommands, if any
+	names := c.visibleSubCommandNames()
+	if len(names) > 0 {
+		help += c.renderSubCommands(names, width, paint)
+	}
+
+	// print the examples, if any
+	if len(c.Examples) > 0 {
+		help += c.renderExamples(width, paint)
+	}
+
+	// print the extended help last
+	if len(c.Help) > 0 {
+		if !strings.HasSuffix(help, "\n\n") {
+			help += "\n"
+		}
+		help += fmt.Sprintf("%s\n", style.Indent(style.Wrap(c.Help)))
+	}
+	return help
+}
+
+// flagColumns returns the flags listed in help, less the short names shown
+// with their long ones, with, for each, its names, e.g. "-c, -cpu", and its
+// flag column, the names and label indented by helpIndent, and the width of
+// the flag column, including the gap before the usage.
+func (c CommandType) flagColumns() (flags []*flag.Flag, flagNames, flagCols map[string]string, flagColWidth int) {
+	// obtain the flags in the flagset and generate the flag column, the
+	// indented name, or short and long names, and label of each flag
+	indent := c.helpIndent()
+	visible := map[string]bool{}
+	c.visitFlags(func(f *flag.Flag) { visible[f.Name] = true })
+	shortFor := map[string]string{} // long name to short name
+	paired := map[string]bool{}     // short names shown with the long
+	for long, short := range c.shortFlags {
+		if visible[long] && visible[short] {
+			shortFor[long] = short
+			paired[short] = true
+		}
+	}
+	flagNames = map[string]string{}
+	flagCols = map[string]string{}
+	maxFlagWidth := 0
+	appendFlag := func(f *flag.Flag) {
+		if paired[f.Name] {
+			return
+		}
+		flags = append(flags, f)
+		names := FlagPrefix + f.Name
+		if short, ok := shortFor[f.Name]; ok {
+			names = FlagPrefix + short + ", " + names
+		}
+		flagNames[f.Name] = names
+		col := fmt.Sprintf("%*s%s ", indent, "", names)
+		if label := c.flagLabel(f); label != "" {
+			col = fmt.Sprintf("%*s%s%s%s", indent, "", names, FlagValueSeparator, label)
+		}
+		flagCols[f.Name] = col
+		if n := utf8.RuneCountInString(col); n > maxFlagWidth && !c.flagColTooWide(n) {
+			maxFlagWidth = n
+		}
+	}
+	c.visitFlags(appendFlag)
+
+	// set width needed to express flagnames, measured, like the padding
+	// in help, in runes, so that the usage and its continuation lines start
+	// in the same column for every flag
+	return flags, flagNames, flagCols, maxFlagWidth + 2 // 2 for space at end
+}
+
+// renderSubCommands returns the sub-commands sections of help, listing the
+// sub-commands called names under the headings of SubCommandGroups.
+func (c CommandType) renderSubCommands(names []string, width int, paint func(code, s string) string) string {
+	indent := c.helpIndent()
+	help := ""
+	maxSubcmdWidth := 0
+	for _, n := range names {
+		if w := utf8.RuneCountInString(c.SubCommands[n].displayName()); w > maxSubcmdWidth {
+			maxSubcmdWidth = w
+		}
+	}
+	cmdStyle := c.newStyle()
+	cmdStyle.MaxWidth = wrapWidth(width, indent+maxSubcmdWidth+2)
+	cmdStyle.IndentWidth = indent + maxSubcmdWidth + 2
+	for _, s := range c.subCommandSections(names) {
+		help += fmt.Sprintf("\n%*s%s\n", indent, "", paint(colorHeader, s.title))
+		for _, n := range s.names {
+			v := c.SubCommands[n]
+			name := fmt.Sprintf("%-*s", maxSubcmdWidth, v.displayName())
+			name = strings.Replace(name, v.Name, paint(colorCommand, v.Name), 1)
+			desc := v.ShortDesc
+			if v.Deprecated != "" {
+				desc = strings.TrimSpace(desc + " " + MsgDeprecatedAnnotation)
+			}
+			help += fmt.Sprintf("%*s%s  %s\n", indent, "", name, cmdStyle.Indent2(cmdStyle.Wrap(desc)))
+		}
+	}
+	return help
+}
+
+// renderExamples returns the Examples section of help wrapped to width.
+func (c CommandType) renderExamples(width int, paint func(code, s string) string) string {
+	indent := c.helpIndent()
+	descStyle := c.newStyle()
+	descStyle.IndentWidth = indent * 3
+	descStyle.MaxWidth = wrapWidth(width, indent*3)
+	help := fmt.Sprintf("\n%*s%s\n", indent, "", paint(colorHeader, ExamplesSectionLabel))
+	for _, e := range c.Examples {
+		help += fmt.Sprintf("%*s%s\n", indent*2, "", e.Command)
+		if e.Description != "" {
+			help += fmt.Sprintf("%s\n", descStyle.Indent(descStyle.Wrap(e.Description)))
+		}
+	}
+	return help
+}
+
+// subCommandSection is a heading and the sub-commands listed beneath it in
+// help.
+type subCommandSection struct {
+	title string
+	names []string
+}
+
+// subCommandSections divides the sub-commands called names into the
+// non-empty SubCommandGroups followed by a section of the remaining
+// sub-commands.
+func (c CommandType) subCommandSections(names []string) []subCommandSection {
+	listed := map[string]bool{}
+	for _, n := range names {
+		listed[n] = true
+	}
+	grouped := map[string]bool{}
+	sections := []subCommandSection{}
+	for _, g := range c.SubCommandGroups {
+		s := subCommandSection{title: g.Title}
+		for _, n := range g.Commands {
+			if listed[n] && !grouped[n] {
+				s.names = append(s.names, n)
+				grouped[n] = true
+			}
+		}
+		if len(s.names) > 0 {
+			sections = append(sections, s)
+		}
+	}
+	rest := subCommandSection{title: fmt.Sprintf(SubCommandsSectionLabel, c.Name)}
+	for _, n := range names {
+		if !grouped[n] {
+			rest.names = append(rest.names, n)
+		}
+	}
+	if len(rest.names) > 0 {
+		sections = append(sections, rest)
+	}
+	return sections
+}
+
+// AliasFlag pairs the flag named short with the flag named long, so that
+// help shows them together on one line, e.g. "-c, -cpu FLOAT", with the
+// usage of long. If short is not defined in Flags, it is defined as another
+// name for long, setting the same value. Either name may be given on the
+// command line, and giving short counts as giving long, e.g. for
+// RequiredFlags.
+func (c *CommandType) AliasFlag(short, long string) {
+	if c.Flags == nil {
+		c.Flags = flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	}
+	if f := c.Flags.Lookup(long); f != nil && c.Flags.Lookup(short) == nil {
+		c.Flags.Var(f.Value, short, f.Usage)
+		c.Flags.Lookup(short).DefValue = f.DefValue
+	}
+	if c.shortFlags == nil {
+		c.shortFlags = map[string]string{}
+	}
+	c.shortFlags[long] = short
+}
+
+// flagColTooWide reports whether a flag column n runes wide exceeds
+// MaxFlagColWidth.
+func (c CommandType) flagColTooWide(n int) bool {
+	return c.MaxFlagColWidth > 0 && n > c.MaxFlagColWidth
+}
+
+// newStyle returns a copy of Style, or a new refmt.Style if it is unset, for
+// the caller to set its widths on.
+func (c CommandType) newStyle() *refmt.Style {
+	if c.Style == nil {
+		return refmt.NewStyle()
+	}
+	style := *c.Style
+	return &style
+}
+
+// wrapWidth returns the width left for wrapped text in a help line of width
+// columns, of which used are taken by indentation or a preceding column. It
+// is never less than 1, so that help can still be rendered when the columns
+// do not fit.
+func wrapWidth(width, used int) int {
+	if width-used < 1 {
+		return 1
+	}
+	return width - used
+}
+
+func (c CommandType) renderHelp(width int) string { return c.RenderHelp(width) }
+
+// visitFlags calls fn for each flag the command reports in help and other
+// documentation: those of allFlags, limited by OwnFlags if set.
+func (c CommandType) visitFlags(fn func(*flag.Flag)) {
+	if len(c.OwnFlags) == 0 {
+		c.allFlags(fn)
+		return
+	}
+	own := map[string]bool{}
+	for _, n := range c.OwnFlags {
+		own[n] = true
+	}
+	for _, n := range c.inherited {
+		own[n] = true
+	}
+	c.allFlags(func(f *flag.Flag) {
+		if own[f.Name] {
+			fn(f)
+		}
+	})
+}
+
+// allFlags calls fn for each flag defined in Flags, if any, other than the
+// help flags added by ProcessArgs.
+func (c CommandType) allFlags(fn func(*flag.Flag)) {
+	if c.Flags == nil {
+		return
+	}
+	c.Flags.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(*helpFlag); !ok {
+			fn(f)
+		}
+	})
+}
+
+// hasFlags reports whether any flags are defined in Flags.
+func (c CommandType) hasFlags() bool {
+	found := false
+	c.visitFlags(func(*flag.Flag) { found = true })
+	return found
+}
+
+// Synopsis returns a usage line for the command generated from its name, an
+// [OPTIONS] token if it has flags, its positional arguments if MinArgs or
+// MaxArgs are set, named by ArgNames, or else the ArgNames themselves, and a
+// COMMAND token if it has sub-commands, e.g. "deploy [OPTIONS] ARG ARG".
+func (c CommandType) Synopsis() string {
+	words := []string{c.Name}
+	if c.hasFlags() {
+		words = append(words, "[OPTIONS]")
+	}
+	switch {
+	case len(c.SubCommands) > 0 && c.DefaultSubCommand != "":
+		words = append(words, "[COMMAND]")
+	case len(c.SubCommands) > 0:
+		words = append(words, "COMMAND")
+	case c.MinArgs != 0 || c.MaxArgs != 0:
+		for i := 0; i < c.MinArgs; i++ {
+			words = append(words, c.argName(i))
+		}
+		if c.MaxArgs < 0 {
+			words = append(words, "["+c.argName(c.MinArgs)+"...]")
+		}
+		for i := c.MinArgs; i < c.MaxArgs; i++ {
+			words = append(words, "["+c.argName(i)+"]")
+		}
+	default:
+		words = append(words, c.ArgNames...)
+	}
+	return strings.Join(words, " ")
+}
+
+// argName returns the name of the i'th positional argument.
+func (c CommandType) argName(i int) string {
+	switch {
+	case len(c.ArgNames) == 0:
+		return "ARG"
+	case i < len(c.ArgNames):
+		return c.ArgNames[i]
+	}
+	return c.ArgNames[len(c.ArgNames)-1]
+}
+
+// FlagTypeLabel returns the placeholder used in help for the value taken by
+// f: UINT, INT, STRING, FLOAT, a label registered with RegisterFlagLabel or
+// VALUE, or "" for boolean flags, which take no value.
+func FlagTypeLabel(f *flag.Flag) string {
+	if label := flagKind(f); label != "BOOL" {
+		return label
+	}
+	return ""
+}
+
+// flagLabel returns the placeholder for f's value from FlagPlaceholders, or
+// FlagTypeLabel if it has none and HideFlagTypeLabels is not set.
+func (c CommandType) flagLabel(f *flag.Flag) string {
+	if label, ok := c.FlagPlaceholders[f.Name]; ok {
+		return label
+	}
+	if c.HideFlagTypeLabels {
+		return ""
+	}
+	return FlagTypeLabel(f)
+}
+
+// flagUsage returns the usage of f, noting if it may be repeated or is
+// deprecated, followed, as by flag.PrintDefaults, by its default value unless
+// that is the zero value for its type.
+func (c CommandType) flagUsage(f *flag.Flag) string {
+	usage := f.Usage
+	if isSliceFlag(f) {
+		usage += " " + MsgRepeatableAnnotation
+	}
+	if _, ok := c.DeprecatedFlags[f.Name]; ok {
+		usage += " " + MsgDeprecatedAnnotation
+	}
+	if isZeroValue(f) {
+		return usage
+	}
+	def := f.DefValue
+	if flagKind(f) == "STRING" {
+		def = strconv.Quote(def)
+	}
+	return usage + " " + fmt.Sprintf(MsgDefaultAnnotation, def)
+}
+
+// isZeroValue reports whether f's default is the zero value of its type,
+// determined as flag.PrintDefaults does by comparing with the String of a
+// newly allocated Value.
+func isZeroValue(f *flag.Flag) (zero bool) {
+	if f.DefValue == "" {
+		return true
+	}
+	defer func() {
+		if recover() != nil {
+			zero = false // String panicked on the new value
+		}
+	}()
+	typ := reflect.TypeOf(f.Value)
+	var z reflect.Value
+	if typ.Kind() == reflect.Ptr {
+		z = reflect.New(typ.Elem())
+	} else {
+		z = reflect.Zero(typ)
+	}
+	return f.DefValue == z.Interface().(flag.Value).String()
+}
+
+// flagKind returns the type of value taken by f: BOOL, UINT, INT, STRING,
+// FLOAT, a label registered with RegisterFlagLabel or, for anything else,
+// including Values that do not implement flag.Getter, VALUE. Values with an
+// IsBoolFlag method that returns true, such as counters, take no argument
+// and so are BOOL. Flags that may be repeated have "..." appended to the
+// type of their elements, e.g. STRING...
+func flagKind(f *flag.Flag) string {
+	if isBoolValue(f.Value) {
+		return "BOOL"
+	}
+	if isSliceFlag(f) {
+		if g, ok := f.Value.(flag.Getter); ok {
+			if v := reflect.ValueOf(g.Get()); v.Kind() == reflect.Slice {
+				return valueKind(reflect.Zero(v.Type().Elem()).Interface()) + "..."
+			}
+		}
+		return "VALUE..."
+	}
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "VALUE" // its type cannot be found without Get
+	}
+	return valueKind(g.Get())
+}
+
+// isSliceFlag reports whether f may be repeated to accumulate values, either
+// because its Value has an IsSliceFlag method that returns true or because
+// the Value's Get method returns a slice.
+func isSliceFlag(f *flag.Flag) bool {
+	if s, ok := f.Value.(interface{ IsSliceFlag() bool }); ok {
+		return s.IsSliceFlag()
+	}
+	g, ok := f.Value.(flag.Getter)
+	return ok && reflect.ValueOf(g.Get()).Kind() == reflect.Slice
+}
+
+// flagLabels maps the types registered with RegisterFlagLabel to their labels.
+var flagLabels = map[reflect.Type]string{}
+
+// RegisterFlagLabel sets the label used in help for flags whose Value
+// implements flag.Getter and returns a value of the same type as sample from
+// Get, e.g.
+//
+//	commandflags.RegisterFlagLabel(time.Duration(0), "DURATION")
+//
+// Labels for the types with built-in labels cannot be changed. It should be
+// called during initialization, before any help is rendered.
+func RegisterFlagLabel(sample interface{}, label string) {
+	flagLabels[reflect.TypeOf(sample)] = label
+}
+
+// valueKind returns the label for a flag value v: BOOL, UINT, INT, STRING,
+// FLOAT, a label registered with RegisterFlagLabel or VALUE.
+func valueKind(v interface{}) string {
+	// Thank frobnitz for figuring this out
+	switch v.(type) {
+	case bool:
+		return "BOOL"
+	case uint64, uint:
+		return "UINT"
+	case int64, int:
+		return "INT"
+	case string:
+		return "STRING"
+	case float64:
+		return "FLOAT"
+	}
+	if label, ok := flagLabels[reflect.TypeOf(v)]; ok {
+		return label
+	}
+	return "VALUE"
+}
+
+// orderFlags returns flags, which are in alphabetical order, with those named
+// in FlagOrder moved to the front in that order.
+func (c CommandType) orderFlags(flags []*flag.Flag) []*flag.Flag {
+	if len(c.FlagOrder) == 0 {
+		return flags
+	}
+	byName := map[string]*flag.Flag{}
+	for _, f := range flags {
+		byName[f.Name] = f
+	}
+	ordered := []*flag.Flag{}
+	listed := map[string]bool{}
+	for _, n := range c.FlagOrder {
+		if f, ok := byName[n]; ok && !listed[n] {
+			ordered = append(ordered, f)
+			listed[n] = true
+		}
+	}
+	for _, f := range flags {
+		if !listed[f.Name] {
+			ordered = append(ordered, f)
+		}
+	}
+	return ordered
+}
+
+// flagSection is a heading and the flags listed beneath it in help.
+type flagSection struct {
+	title string
+	flags []*flag.Flag
+}
+
+// flagSections divides flags into the non-empty FlagGroups followed by a
+// section of the remaining flags in FlagOrder, less those inherited from the
+// parent, which follow in a section of their own.
+func (c CommandType) flagSections(flags []*flag.Flag) []flagSection {
+	flags = c.orderFlags(flags)
+	byName := map[string]*flag.Flag{}
+	for _, f := range flags {
+		byName[f.Name] = f
+	}
+	grouped := map[string]bool{}
+	sections := []flagSection{}
+	for _, g := range c.FlagGroups {
+		s := flagSection{title: g.Title}
+		for _, n := range g.Flags {
+			if f, ok := byName[n]; ok && !grouped[n] {
+				s.flags = append(s.flags, f)
+				grouped[n] = true
+			}
+		}
+		if len(s.flags) > 0 {
+			sections = append(sections, s)
+		}
+	}
+	inherited := map[string]bool{}
+	for _, n := range c.inherited {
+		inherited[n] = true
+	}
+	rest := flagSection{title: fmt.Sprintf(FlagsSectionLabel, c.Name)}
+	global := flagSection{title: GlobalFlagsSectionLabel}
+	for _, f := range flags {
+		switch {
+		case grouped[f.Name]:
+		case inherited[f.Name]:
+			global.flags = append(global.flags, f)
+		default:
+			rest.flags = append(rest.flags, f)
+		}
+	}
+	for _, s := range []flagSection{rest, global} {
+		if len(s.flags) > 0 {
+			sections = append(sections, s)
+		}
+	}
+	return sections
+}
+
+// usageError returns a UsageError for c with the message msg. If c.Output is
+// set the help is written there and msg (less any trailing colon) is the whole
+// message, otherwise the help is appended to msg. If c.QuietErrors is set
+// there is no help at all.
+func (c *CommandType) usageError(msg string, path, args []string) UsageError {
+	if c.QuietErrors {
+		return UsageError{e: strings.TrimSuffix(msg, ":"), c: c, a: args, p: path}
+	}
+	help := c.renderHelp(c.helpWidth())
+	if c.Output != nil {
+		fmt.Fprint(c.Output, help)
+		return UsageError{e: strings.TrimSuffix(msg, ":"), c: c, a: args, p: path}
+	}
+	return UsageError{e: msg + "\n" + help, m: strings.TrimSuffix(msg, ":"), c: c, a: args, p: path}
+}
+
+// PrintHelp writes the command's help to w. If w is a terminal, the help is
+// wrapped to the terminal's width and colored unless NO_COLOR is set.
+// Otherwise it is wrapped to $COLUMNS, if that holds a positive integer, or
+// else to Width or DefaultWidth.
+func (c CommandType) PrintHelp(w io.Writer) {
+	fmt.Fprint(w, c.render(c.termWidth(w), colorEnabled(w)))
+}
+
+// Usage prints the command's help to os.Stderr, like PrintHelp. It has the
+// signature of flag.FlagSet's Usage field, so that
+//
+//	c.Flags.Usage = c.Usage
+//
+// makes the command's help print when a direct call of c.Flags.Parse fails,
+// as the flag package does. ProcessArgs parses a copy of Flags and never
+// calls Flags.Usage; it reports parse errors in a FlagError, with the help
+// written to Output, if set, or else embedded in the error's message.
+func (c *CommandType) Usage() {
+	c.PrintHelp(os.Stderr)
+}
+
+// colorEnabled reports whether help written to w should be colored: never if
+// NO_COLOR is set, otherwise if Color is set or w is a terminal.
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if Color {
+		return true
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// helpIndent returns Indent if set, otherwise HelpIndent.
+func (c CommandType) helpIndent() int {
+	if c.Indent != 0 {
+		return c.Indent
+	}
+	return HelpIndent
+}
+
+// helpWidth returns Width if set, otherwise DefaultWidth.
+func (c CommandType) helpWidth() int {
+	if c.Width != 0 {
+		return c.Width
+	}
+	return DefaultWidth
+}
+
+// termWidth returns the width of the terminal attached to w, or when w is
+// not a terminal, $COLUMNS if it is valid and otherwise helpWidth.
+func (c CommandType) termWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return c.helpWidth()
+}
+
+// copyFlagSet returns a new FlagSet named name that defines the flags of fs,
+// sharing their Values, and reports parse errors only by returning them.
+func copyFlagSet(name string, fs *flag.FlagSet) *flag.FlagSet {
+	cp := flag.NewFlagSet(name, flag.ContinueOnError)
+	cp.Usage = func() {}
+	cp.SetOutput(io.Discard) // parse errors are reported in FlagError
+	fs.VisitAll(func(f *flag.Flag) {
+		cp.Var(f.Value, f.Name, f.Usage)
+		cp.Lookup(f.Name).DefValue = f.DefValue
+	})
+	return cp
+}
+
+// resetFlags returns the flags in fs to their default values, so that values
+// from an earlier parse do not leak into the next when a flagset is shared by
+// several commands or a command is processed more than once. Only flags whose
+// Value implements flag.Getter, as those of the flag package's typed flags
+// do, are reset, since setting other Values, such as those of flag.Func, may
+// have side effects. Flags that may be repeated are reset only if their
+// Value has a Reset method. Values in done are left alone, and the values
+// reset are added to it, so that a value shared by several flags, or
+// FlagSets, is reset only once.
+func resetFlags(fs *flag.FlagSet, done map[flag.Value]bool) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if reflect.TypeOf(f.Value).Comparable() {
+			if done[f.Value] {
+				return
+			}
+			done[f.Value] = true
+		}
+		if r, ok := f.Value.(interface{ Reset() }); ok && isSliceFlag(f) {
+			r.Reset()
+			return
+		}
+		if _, ok := f.Value.(flag.Getter); !ok || isSliceFlag(f) {
+			return
+		}
+		if f.Value.String() != f.DefValue {
+			_ = f.Value.Set(f.DefValue)
+		}
+	})
+}
+
+// parseFlags parses args with c.Flags. If CollectAllFlagErrors is set,
+// parsing resumes after each bad flag and the messages of all errors are
+// combined into one.
+func (c *CommandType) parseFlags(args []string) error {
+	err := c.Flags.Parse(args)
+	if err == nil || !c.CollectAllFlagErrors {
+		return err
+	}
+	msgs := []string{err.Error()}
+	for err != nil {
+		rest := c.Flags.Args()
+		if len(rest) == len(args) {
+			rest = rest[1:] // the bad token was not consumed
+		}
+		args = rest
+		if err = c.Flags.Parse(args); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// missingFlags returns the RequiredFlags that were left at their defaults
+// according to sources, formatted as they would be typed on the command line.
+func (c CommandType) missingFlags(sources map[string]FlagSource) []string {
+	missing := []string{}
+	for _, name := range c.RequiredFlags {
+		if sources[name] == SourceDefault {
+			missing = append(missing, "-"+name)
+		}
+	}
+	return missing
+}
+
+// conflictingFlags returns, for each MutuallyExclusive group with more than
+// one flag set on the command line according to sources, those flags joined
+// by commas. Values from the environment or DefaultsFile do not conflict.
+func (c CommandType) conflictingFlags(sources map[string]FlagSource) []string {
+	conflicts := []string{}
+	for _, group := range c.MutuallyExclusive {
+		given := []string{}
+		for _, name := range group {
+			if sources[name] == SourceCommandLine {
+				given = append(given, "-"+name)
+			}
+		}
+		if len(given) > 1 {
+			conflicts = append(conflicts, strings.Join(given, ", "))
+		}
+	}
+	return conflicts
+}
+
+// argCountOK reports whether n positional arguments satisfy MinArgs and
+// MaxArgs.
+func (c CommandType) argCountOK(n int) bool {
+	if c.MinArgs == 0 && c.MaxArgs == 0 {
+		return true
+	}
+	return n >= c.MinArgs && (c.MaxArgs < 0 || n <= c.MaxArgs)
+}
+
+// argCountMessage describes the problem with n positional arguments: the
+// first missing argument, if it is named and there are too few, or else the
+// count expected, followed by the command's Synopsis.
+func (c CommandType) argCountMessage(n int) string {
+	msg := fmt.Sprintf(MsgArgCount, c.argCountRange(), n)
+	if n < c.MinArgs && len(c.ArgNames) > 0 {
+		msg = fmt.Sprintf(MsgMissingArgument, c.Name, c.argName(n))
+	}
+	return msg + "\n" + fmt.Sprintf(MsgSynopsis, c.Synopsis())
+}
+
+// argCountRange describes the accepted number of positional arguments, e.g.
+// "at least 1" or "2 to 3".
+func (c CommandType) argCountRange() string {
+	switch {
+	case c.MaxArgs < 0:
+		return fmt.Sprintf(MsgArgsAtLeast, c.MinArgs)
+	case c.MinArgs == c.MaxArgs:
+		return fmt.Sprintf(MsgArgsExactly, c.MinArgs)
+	case c.MinArgs == 0:
+		return fmt.Sprintf(MsgArgsAtMost, c.MaxArgs)
+	}
+	return fmt.Sprintf(MsgArgsRange, c.MinArgs, c.MaxArgs)
+}
+
+// visibleSubCommandNames returns subCommandNames less those that are Hidden.
+func (c CommandType) visibleSubCommandNames() []string {
+	names := []string{}
+	for _, n := range c.subCommandNames() {
+		if !c.SubCommands[n].Hidden {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// invalidCommand returns the message for an InvalidCommandError for name,
+// given to c, reached by path, including a suggestion of what may have been
+// meant. Below the root, the message names the path, so that it is clear
+// where in the tree name was not found.
+func (c CommandType) invalidCommand(path []string, name string) string {
+	if m := c.prefixMatches(name); len(m) > 1 {
+		return fmt.Sprintf(MsgAmbiguousCommand, name, strings.Join(m, ", "))
+	}
+	msg := fmt.Sprintf(MsgInvalidCommand, name)
+	if len(path) > 1 {
+		msg = fmt.Sprintf(MsgInvalidCommandAt, strings.Join(path, " "), name)
+	}
+	if s := c.suggest(name); s != "" {
+		msg += "\n" + fmt.Sprintf(MsgDidYouMean, s)
+	}
+	return msg
+}
+
+// lookupSubCommand returns the subcommand called name, matching either its
+// key in SubCommands or one of its Aliases.
+func (c CommandType) lookupSubCommand(name string) (CommandType, bool) {
+	if sc, ok := c.SubCommands[name]; ok {
+		return sc, true
+	}
+	for _, n := range c.subCommandNames() {
+		sc := c.SubCommands[n]
+		for _, a := range sc.Aliases {
+			if a == name {
+				return sc, true
+			}
+		}
+	}
+	if c.CaseInsensitive {
+		for _, n := range c.subCommandNames() {
+			sc := c.SubCommands[n]
+			for _, a := range append([]string{n}, sc.Aliases...) {
+				if strings.EqualFold(a, name) {
+					return sc, true
+				}
+			}
+		}
+	}
+	if m := c.prefixMatches(name); len(m) == 1 {
+		return c.SubCommands[m[0]], true
+	}
+	return CommandType{}, false
+}
+
+// prefixMatches returns, if AllowPrefixMatch is set, the visible sub-commands
+// with a name or alias that starts with prefix.
+func (c CommandType) prefixMatches(prefix string) []string {
+	matches := []string{}
+	if !c.AllowPrefixMatch || prefix == "" {
+		return matches
+	}
+	fold := func(s string) string { return s }
+	if c.CaseInsensitive {
+		fold = strings.ToLower
+	}
+	for _, n := range c.visibleSubCommandNames() {
+		for _, a := range append([]string{n}, c.SubCommands[n].Aliases...) {
+			if strings.HasPrefix(fold(a), fold(prefix)) {
+				matches = append(matches, n)
+				break
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// displayName returns the command's name as listed in its parent's help,
+// followed by any aliases, e.g. "deploy (dep, d)".
+func (c CommandType) displayName() string {
+	if len(c.Aliases) == 0 {
+		return c.Name
+	}
+	return fmt.Sprintf("%s (%s)", c.Name, strings.Join(c.Aliases, ", "))
+}
+
+// subCommandNames returns the keys of the SubCommands map in display order:
+// those named in SubCommandOrder first, then the rest alphabetically.
+func (c CommandType) subCommandNames() []string {
+	names := make([]string, 0, len(c.SubCommands))
+	seen := map[string]bool{}
+	for _, n := range c.SubCommandOrder {
+		if _, ok := c.SubCommands[n]; ok && !seen[n] {
+			names = append(names, n)
+			seen[n] = true
+		}
+	}
+	rest := []string{}
+	for n := range c.SubCommands {
+		if !seen[n] {
+			rest = append(rest, n)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
 }
@@ -0,0 +1,563 @@
+package commandflags
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// runArgs processes args with c and returns the arguments passed to the
+// resolved command's Run handler.
+func runArgs(t *testing.T, c *CommandType, args ...string) []string {
+	t.Helper()
+	res, err := c.Process(args)
+	if err != nil {
+		t.Fatalf("Process(%q): %v", args, err)
+	}
+	return res.Args
+}
+
+func TestPassUnknownFlagsNormalized(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	retries := fs.Int("max_retries", 0, "retry count")
+	c := NewCommandType("mytool", fs)
+	c.NormalizeFlagName = func(s string) string { return strings.ReplaceAll(s, "_", "-") }
+	c.PassUnknownFlags = true
+	c.Run = func([]string) error { return nil }
+
+	got := runArgs(t, &c, "--max-retries", "3", "--other=1", "x")
+	if want := []string{"--other=1", "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+	if *retries != 3 {
+		t.Errorf("max_retries = %d, want 3", *retries)
+	}
+}
+
+func TestPassUnknownFlagsBundled(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	v := fs.Bool("v", false, "verbose")
+	d := fs.Bool("d", false, "debug")
+	c := NewCommandType("mytool", fs)
+	c.AllowBundledShortFlags = true
+	c.PassUnknownFlags = true
+	c.Run = func([]string) error { return nil }
+
+	got := runArgs(t, &c, "-vd", "--other=1", "x")
+	if want := []string{"--other=1", "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+	if !*v || !*d {
+		t.Errorf("v, d = %v, %v, want true, true", *v, *d)
+	}
+}
+
+func TestPassUnknownFlagsAliased(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	count := fs.Int("count", 1, "instance count")
+	c := NewCommandType("mytool", fs)
+	c.FlagAliases = map[string]string{"instances": "count"}
+	c.PassUnknownFlags = true
+	c.Run = func([]string) error { return nil }
+
+	res, err := c.Process([]string{"-instances", "3", "--other=1", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--other=1", "x"}; !reflect.DeepEqual(res.Args, want) {
+		t.Errorf("args = %q, want %q", res.Args, want)
+	}
+	if *count != 3 {
+		t.Errorf("count = %d, want 3", *count)
+	}
+	if len(res.Deprecations) != 1 {
+		t.Errorf("deprecations = %q, want one notice", res.Deprecations)
+	}
+}
+
+func TestHelpCacheInheritedFlags(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	fs.Bool("verbose", false, "verbose output")
+	c := NewCommandType("mytool", fs)
+	c.InheritFlags = true
+	deploy := NewCommandType("deploy", flag.NewFlagSet("deploy", flag.ContinueOnError))
+	deploy.Run = func([]string) error { return nil }
+	c.AddSubCommand(deploy)
+	c.CacheHelp()
+
+	plain := c.SubCommands["deploy"].RenderHelp(200)
+	if strings.Contains(plain, "-verbose") {
+		t.Fatalf("help before inheriting shows -verbose:\n%s", plain)
+	}
+	sc, _, err := c.Resolve([]string{"deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if help := sc.RenderHelp(200); !strings.Contains(help, "-verbose") {
+		t.Errorf("help after inheriting lacks -verbose:\n%s", help)
+	}
+	if help := c.SubCommands["deploy"].RenderHelp(200); help != plain {
+		t.Errorf("help before inheriting changed to:\n%s", help)
+	}
+}
+
+func TestHelpFlagsNotLeftDefined(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	c := NewCommandType("mytool", fs)
+	c.Version = "mytool 1.0"
+	c.Run = func([]string) error { return nil }
+
+	if _, err := c.ProcessArgs([]string{"-h"}); err == nil {
+		t.Fatal("-h: no HelpRequestedError")
+	}
+	for _, name := range append([]string{"version"}, HelpFlagNames...) {
+		if fs.Lookup(name) != nil {
+			t.Errorf("-%s left defined in the FlagSet", name)
+		}
+	}
+	fs.Bool("h", false, "human readable sizes") // panics if -h is still defined
+}
+
+func TestVersionFlagOnlyOnRoot(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	fs.Bool("verbose", false, "verbose output")
+	c := NewCommandType("mytool", fs)
+	c.Version = "mytool 1.0"
+	c.InheritFlags = true
+	deploy := NewCommandType("deploy", fs)
+	deploy.Run = func([]string) error { return nil }
+	c.AddSubCommand(deploy)
+
+	if _, err := c.ProcessArgs([]string{"-version"}); !errors.Is(err, ErrVersionRequested) {
+		t.Errorf("mytool -version: %v, want a VersionRequestedError", err)
+	}
+	if _, err := c.ProcessArgs([]string{"deploy", "-version"}); !errors.Is(err, ErrFlag) {
+		t.Errorf("mytool deploy -version: %v, want a FlagError", err)
+	}
+	_, err := c.ProcessArgs([]string{"deploy", "-h"})
+	if !errors.Is(err, ErrHelpRequested) {
+		t.Fatalf("mytool deploy -h: %v, want a HelpRequestedError", err)
+	}
+	if help := err.Error(); strings.Contains(help, "-version") {
+		t.Errorf("deploy help lists -version:\n%s", help)
+	}
+}
+
+func TestManPagesSeeAlso(t *testing.T) {
+	c := NewCommandType("mytool", nil)
+	deploy := NewCommandType("deploy", nil)
+	deploy.AddSubCommand(NewCommandType("status", nil))
+	c.AddSubCommand(deploy)
+
+	pages := c.ManPages(1)
+	for name, page := range pages {
+		for _, line := range strings.Split(page, "\n") {
+			if !strings.HasPrefix(line, ".BR ") {
+				continue
+			}
+			ref := strings.ReplaceAll(strings.Fields(line)[1], `\-`, "-")
+			if _, ok := pages[ref]; !ok {
+				t.Errorf("%s refers to %s, which is not among %d pages", name, ref, len(pages))
+			}
+		}
+	}
+	if _, ok := pages["mytool-deploy-status"]; !ok {
+		t.Errorf("no page mytool-deploy-status")
+	}
+}
+
+func TestHelpTemplateErrorTraced(t *testing.T) {
+	var trace bytes.Buffer
+	c := NewCommandType("mytool", nil)
+	c.ShortDesc = "does things"
+	c.HelpTemplate = template.Must(template.New("help").Parse("{{.NoSuchField}}"))
+	c.Trace = &trace
+
+	if help := c.RenderHelp(80); !strings.Contains(help, "does things") {
+		t.Errorf("help does not fall back to the built-in layout:\n%s", help)
+	}
+	if !strings.Contains(trace.String(), "help template:") {
+		t.Errorf("trace = %q, want the template error", trace.String())
+	}
+}
+
+// newMytool returns a command tree like the example's, in which every
+// command shares one FlagSet, along with the value of its -m flag.
+func newMytool() (CommandType, *int) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	fs.Bool("verbose", false, "Enable verbose output")
+	fs.Float64("c", 1.0, "cpu share")
+	mem := fs.Int("m", 32, "memory share (MB)")
+	run := func([]string) error { return nil }
+
+	c := NewCommandType("mytool", fs)
+	for _, name := range []string{"deploy", "create"} {
+		sc := NewCommandType(name, fs)
+		sc.ShortDesc = name + " an app"
+		sc.Run = run
+		c.AddSubCommand(sc)
+	}
+	deployments := NewCommandType("deployments", fs)
+	deployments.ShortDesc = "manage the deployments of an app"
+	for _, name := range []string{"status", "destroy"} {
+		sc := NewCommandType(name, fs)
+		sc.ShortDesc = name + " the deployments"
+		sc.Run = run
+		deployments.AddSubCommand(sc)
+	}
+	c.AddSubCommand(deployments)
+	exec := NewCommandType("exec", nil)
+	exec.ShortDesc = "run a program"
+	exec.CaptureRest = true
+	exec.Run = run
+	c.AddSubCommand(exec)
+	return c, mem
+}
+
+func TestSiblingsDoNotLeakFlags(t *testing.T) {
+	c, mem := newMytool()
+	if runArgs(t, &c, "deploy", "-m", "64"); *mem != 64 {
+		t.Fatalf("deploy -m 64: m = %d, want 64", *mem)
+	}
+	if runArgs(t, &c, "create"); *mem != 32 {
+		t.Errorf("create after deploy -m 64: m = %d, want 32", *mem)
+	}
+	if runArgs(t, &c, "-m", "64", "deployments", "status"); *mem != 64 {
+		t.Errorf("-m 64 deployments status: m = %d, want 64", *mem)
+	}
+	if runArgs(t, &c, "deployments", "destroy"); *mem != 32 {
+		t.Errorf("deployments destroy after -m 64: m = %d, want 32", *mem)
+	}
+}
+
+func TestRenderHelpNarrow(t *testing.T) {
+	c, _ := newMytool()
+	c.LongDesc = "This tool demonstrates commandflags with a description long enough to wrap."
+	for width := 1; width <= 200; width++ {
+		c.RenderHelp(width)
+		c.SubCommands["deployments"].RenderHelp(width)
+	}
+}
+
+func TestDoubleDashArgs(t *testing.T) {
+	c, _ := newMytool()
+	got := runArgs(t, &c, "deploy", "--", "--weird-arg")
+	if want := []string{"--weird-arg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
+
+func TestHelpLongFlagGolden(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	fs.Bool("v", false, "verbose output")
+	fs.String("a-very-long-flag-name-indeed", "", "a long usage string that goes on and on so that it has to be wrapped over several lines of help")
+	c := NewCommandType("mytool", fs)
+	c.ShortDesc = "does things"
+
+	want := `Command: mytool
+  does things
+
+  mytool flags:
+  -a-very-long-flag-name-indeed STRING  a long usage string
+                                        that goes on and on
+                                        so that it has to be
+                                        wrapped over several
+                                        lines of help
+  -v                                    verbose output
+`
+	if got := c.RenderHelp(60); got != want {
+		t.Errorf("help =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHelpFlagTypeLabelsGolden(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	fs.Bool("verbose", false, "Enable verbose output")
+	fs.Float64("c", 1.0, "cpu share")
+	fs.Int("m", 32, "memory share (MB)")
+	c := NewCommandType("mytool", fs)
+	c.ShortDesc = "does things"
+
+	for _, tt := range []struct {
+		hide bool
+		want string
+	}{
+		{false, `Command: mytool
+  does things
+
+  mytool flags:
+  -c FLOAT   cpu share (default 1)
+  -m INT     memory share (MB) (default 32)
+  -verbose   Enable verbose output
+`},
+		{true, `Command: mytool
+  does things
+
+  mytool flags:
+  -c         cpu share (default 1)
+  -m         memory share (MB) (default 32)
+  -verbose   Enable verbose output
+`},
+	} {
+		c.HideFlagTypeLabels = tt.hide
+		if got := c.RenderHelp(200); got != tt.want {
+			t.Errorf("HideFlagTypeLabels=%v: help =\n%s\nwant\n%s", tt.hide, got, tt.want)
+		}
+	}
+}
+
+func TestFlagWhereCommandExpected(t *testing.T) {
+	c, _ := newMytool()
+	for _, tt := range []struct{ arg, token string }{{"-x", "-x"}, {"--x=1", "--x=1"}, {"-", "-"}} {
+		_, err := c.ProcessArgs([]string{"deployments", tt.arg})
+		if !errors.Is(err, ErrInvalidCommand) {
+			t.Errorf("mytool deployments %s: %v, want an InvalidCommandError", tt.arg, err)
+			continue
+		}
+		if want := []string{"mytool", "deployments"}; !reflect.DeepEqual(err.Path(), want) {
+			t.Errorf("mytool deployments %s: path = %q, want %q", tt.arg, err.Path(), want)
+		}
+		if want := fmt.Sprintf(MsgFlagNotCommand, tt.token); !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("mytool deployments %s: error = %q, want it to start with %q", tt.arg, err.Error(), want)
+		}
+	}
+
+	// an undefined flag followed by a sub-command name is a bad flag
+	if _, err := c.ProcessArgs([]string{"deployments", "-x", "status"}); !errors.Is(err, ErrFlag) {
+		t.Errorf("mytool deployments -x status: %v, want a FlagError", err)
+	}
+}
+
+func TestCaptureRest(t *testing.T) {
+	c, _ := newMytool()
+	got := runArgs(t, &c, "exec", "ls", "-la", "/tmp")
+	if want := []string{"ls", "-la", "/tmp"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
+
+func TestEqualsFlagAtEveryLevel(t *testing.T) {
+	for _, args := range [][]string{
+		{"--m=64", "deploy"},
+		{"deploy", "--m=64"},
+		{"--m=64", "deployments", "status"},
+		{"deployments", "--m=64", "status"},
+		{"deployments", "status", "--m=64"},
+	} {
+		c, mem := newMytool()
+		if runArgs(t, &c, args...); *mem != 64 {
+			t.Errorf("%q: m = %d, want 64", args, *mem)
+		}
+	}
+}
+
+// legacyValue is a flag.Value that does not implement flag.Getter.
+type legacyValue struct{ s string }
+
+func (v *legacyValue) String() string     { return v.s }
+func (v *legacyValue) Set(s string) error { v.s = s; return nil }
+
+func TestNonGetterFlag(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	v := &legacyValue{}
+	fs.Var(v, "legacy", "a value without Get")
+	c := NewCommandType("mytool", fs)
+	c.Run = func([]string) error { return nil }
+
+	if help := c.RenderHelp(200); !strings.Contains(help, "-legacy VALUE") {
+		t.Errorf("help lacks -legacy VALUE:\n%s", help)
+	}
+	if runArgs(t, &c, "-legacy", "x"); v.s != "x" {
+		t.Errorf("legacy = %q, want x", v.s)
+	}
+}
+
+func TestAmbiguousPrefix(t *testing.T) {
+	c, _ := newMytool()
+	c.AllowPrefixMatch = true
+
+	_, err := c.ProcessArgs([]string{"dep"})
+	if !errors.Is(err, ErrInvalidCommand) {
+		t.Fatalf("mytool dep: %v, want an InvalidCommandError", err)
+	}
+	if want := "Ambiguous COMMAND 'dep': deploy, deployments"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("error = %q, want it to start with %q", err.Error(), want)
+	}
+	res, err := c.Process([]string{"deploym", "status"})
+	if err != nil {
+		t.Fatalf("mytool deploym status: %v", err)
+	}
+	if got, want := res.CommandPath(), "mytool deployments status"; got != want {
+		t.Errorf("path = %q, want %q", got, want)
+	}
+}
+
+func TestEnvSkipsBuiltinFlags(t *testing.T) {
+	t.Setenv("MYTOOL_VERSION", "2.3.4")
+	t.Setenv("MYTOOL_HELP", "true")
+	c, _ := newMytool()
+	c.Version = "mytool 1.0"
+	c.EnvPrefix = "MYTOOL"
+	runArgs(t, &c, "deploy")
+}
+
+func TestDefaultsFileSkipsBuiltinFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "defaults")
+	if err := os.WriteFile(file, []byte("help=true\nversion=true\nm=64\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	mem := fs.Int("m", 32, "memory share (MB)")
+	c := NewCommandType("mytool", fs)
+	c.Version = "mytool 1.0"
+	c.DefaultsFile = file
+	c.Run = func([]string) error { return nil }
+	if runArgs(t, &c); *mem != 64 {
+		t.Errorf("m = %d, want 64", *mem)
+	}
+}
+
+// tagsValue is a repeatable flag.Value that can be reset between runs.
+type tagsValue []string
+
+func (v *tagsValue) String() string     { return strings.Join(*v, ",") }
+func (v *tagsValue) Set(s string) error { *v = append(*v, s); return nil }
+func (v *tagsValue) Get() interface{}   { return []string(*v) }
+func (v *tagsValue) Reset()             { *v = nil }
+
+func TestEnvSetOncePerRun(t *testing.T) {
+	t.Setenv("MYTOOL_TAG", "a")
+	c, _ := newMytool()
+	var tags tagsValue
+	c.Flags.Var(&tags, "tag", "a tag")
+	c.EnvPrefix = "MYTOOL"
+	for i := 0; i < 2; i++ {
+		runArgs(t, &c, "deployments", "status")
+		if want := (tagsValue{"a"}); !reflect.DeepEqual(tags, want) {
+			t.Errorf("run %d: tags = %q, want %q", i, tags, want)
+		}
+	}
+}
+
+func TestCloneKeepsAliasFlag(t *testing.T) {
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	fs.Float64("cpu", 1.0, "cpu share")
+	c := NewCommandType("mytool", fs)
+	c.AliasFlag("c", "cpu")
+	c.Run = func([]string) error { return nil }
+
+	clone := c.Clone()
+	runArgs(t, &clone, "-c", "4")
+	if got := clone.Flags.Lookup("cpu").Value.String(); got != "4" {
+		t.Errorf("cpu = %s after -c 4, want 4", got)
+	}
+	if got := fs.Lookup("cpu").Value.String(); got != "1" {
+		t.Errorf("original cpu = %s, want 1", got)
+	}
+}
+
+func TestPassUnknownFlagsDefaultSubCommand(t *testing.T) {
+	c, _ := newMytool()
+	c.PassUnknownFlags = true
+	deployments := c.SubCommands["deployments"]
+	deployments.PassUnknownFlags = true
+	deployments.DefaultSubCommand = "status"
+	sc := deployments.SubCommands["status"]
+	sc.PassUnknownFlags = true
+	deployments.AddSubCommand(sc)
+	c.AddSubCommand(deployments)
+
+	res, err := c.Process([]string{"deployments", "--x=1"})
+	if err != nil {
+		t.Fatalf("mytool deployments --x=1: %v", err)
+	}
+	if got, want := res.CommandPath(), "mytool deployments status"; got != want {
+		t.Errorf("path = %q, want %q", got, want)
+	}
+	if want := []string{"--x=1"}; !reflect.DeepEqual(res.Args, want) {
+		t.Errorf("args = %q, want %q", res.Args, want)
+	}
+
+	deployments.DefaultSubCommand = ""
+	c.AddSubCommand(deployments)
+	if _, err := c.Process([]string{"deployments", "--x=1"}); !errors.Is(err, ErrMissingCommand) {
+		t.Errorf("mytool deployments --x=1 without a default: %v, want a MissingCommandError", err)
+	}
+}
+
+func TestResolveError(t *testing.T) {
+	c, _ := newMytool()
+	cmd, _, err := c.Resolve([]string{"deploy", "-bogus"})
+	if !errors.Is(err, ErrFlag) {
+		t.Fatalf("mytool deploy -bogus: %v, want a FlagError", err)
+	}
+	if cmd == nil || cmd.Name != "deploy" || cmd != err.CommandType() {
+		t.Errorf("command = %v, want deploy, as from the error", cmd)
+	}
+}
+
+func TestDefaultHelpTemplate(t *testing.T) {
+	c, _ := newMytool()
+	c.LongDesc = "This tool demonstrates commandflags with a description long enough to wrap."
+	c.Help = "See the README for more."
+	c.AliasFlag("v", "verbose")
+	c.Flags.String("a-very-long-flag-name-indeed", "", "a long usage string that has to be wrapped")
+	c.MaxFlagColWidth = 24
+	c.Examples = []Example{{Command: "mytool deploy -m 64", Description: "deploy with more memory than usual"}}
+	c.SubCommandGroups = []SubCommandGroup{{Title: "Deploying:", Commands: []string{"deploy", "create"}}}
+	deploy := c.SubCommands["deploy"]
+	deploy.Aliases = []string{"d"}
+	c.AddSubCommand(deploy)
+	create := c.SubCommands["create"]
+	create.Deprecated = "use deploy"
+	c.AddSubCommand(create)
+	plain := NewCommandType("plain", nil)
+	plain.ShortDesc = "a command with nothing but a description"
+	help := NewCommandType("help", nil)
+	help.Help = "only extended help"
+
+	tmpl := template.Must(template.New("help").Funcs(HelpFuncs).Parse(DefaultHelpTemplate))
+	var trace bytes.Buffer
+	for _, cmd := range []CommandType{c, c.SubCommands["deployments"], plain, help} {
+		cmd.Trace = &trace
+		for _, width := range []int{20, 40, 80, 200} {
+			want := cmd.RenderHelp(width)
+			cmd.HelpTemplate = tmpl
+			if got := cmd.RenderHelp(width); got != want {
+				t.Errorf("%s at width %d: help =\n%s\nwant\n%s", cmd.Name, width, got, want)
+			}
+			cmd.HelpTemplate = nil
+		}
+	}
+	if trace.Len() > 0 {
+		t.Errorf("trace = %q, want no template errors", trace.String())
+	}
+}
+
+func TestResultOmitsBuiltinFlags(t *testing.T) {
+	var trace bytes.Buffer
+	fs := flag.NewFlagSet("mytool", flag.ContinueOnError)
+	fs.Bool("verbose", false, "verbose output")
+	c := NewCommandType("mytool", fs)
+	c.Version = "mytool 1.0"
+	c.Trace = &trace
+	c.Run = func([]string) error { return nil }
+
+	res, err := c.Process([]string{"-verbose"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []map[string]FlagSource{{"verbose": SourceCommandLine}}; !reflect.DeepEqual(res.Sources, want) {
+		t.Errorf("sources = %v, want %v", res.Sources, want)
+	}
+	if strings.Contains(trace.String(), "-version") {
+		t.Errorf("trace mentions -version:\n%s", trace.String())
+	}
+}
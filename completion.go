@@ -0,0 +1,190 @@
+package commandflags
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// BashCompletion returns a bash script that completes sub-command names at
+// each level of the command tree and flag names for the current command when
+// the program is invoked as progName. Hidden commands are omitted. The script
+// is typically loaded with:
+//
+//	source <(mytool completion bash)
+func (c CommandType) BashCompletion(progName string) string {
+	fn := "_" + shellIdent(progName) + "_completion"
+	transitions := ""
+	replies := ""
+	c.completionWalk([]string{progName}, func(path []string, cmd CommandType) {
+		here := strings.Join(path, " ")
+		words := cmd.completionFlags()
+		for _, n := range cmd.visibleSubCommandNames() {
+			sc := cmd.SubCommands[n]
+			words = append(words, n)
+			pats := []string{fmt.Sprintf("%q", here+" "+n)}
+			for _, a := range sc.Aliases {
+				pats = append(pats, fmt.Sprintf("%q", here+" "+a))
+			}
+			transitions += fmt.Sprintf("\t\t%s) cmdpath=%q ;;\n", strings.Join(pats, "|"), here+" "+n)
+		}
+		replies += fmt.Sprintf("\t%q)\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\t;;\n", here, strings.Join(words, " "))
+	})
+
+	script := fmt.Sprintf("# bash completion for %s\n", progName)
+	script += fmt.Sprintf("%s() {\n", fn)
+	script += "\tlocal cur cmdpath i\n"
+	script += "\tcur=\"${COMP_WORDS[COMP_CWORD]}\"\n"
+	script += fmt.Sprintf("\tcmdpath=%q\n", progName)
+	script += "\tfor ((i = 1; i < COMP_CWORD; i++)); do\n"
+	script += "\t\tcase \"$cmdpath ${COMP_WORDS[i]}\" in\n"
+	script += transitions
+	script += "\t\tesac\n"
+	script += "\tdone\n"
+	script += "\tcase \"$cmdpath\" in\n"
+	script += replies
+	script += "\tesac\n"
+	script += "}\n"
+	script += fmt.Sprintf("complete -F %s %s\n", fn, progName)
+	return script
+}
+
+// ZshCompletion returns a zsh completion script for the command tree invoked
+// as progName. Sub-commands are completed with their ShortDesc and flags with
+// their usage string as descriptions. Hidden commands are omitted.
+func (c CommandType) ZshCompletion(progName string) string {
+	fn := "_" + shellIdent(progName)
+	transitions := ""
+	cases := ""
+	c.completionWalk([]string{progName}, func(path []string, cmd CommandType) {
+		here := strings.Join(path, " ")
+		cmds := []string{}
+		for _, n := range cmd.visibleSubCommandNames() {
+			sc := cmd.SubCommands[n]
+			cmds = append(cmds, shellQuote(zshEscape(n)+":"+oneLine(sc.ShortDesc)))
+			pats := []string{fmt.Sprintf("%q", here+" "+n)}
+			for _, a := range sc.Aliases {
+				pats = append(pats, fmt.Sprintf("%q", here+" "+a))
+			}
+			transitions += fmt.Sprintf("\t\t%s) cmdpath=%q ;;\n", strings.Join(pats, "|"), here+" "+n)
+		}
+		flags := []string{}
+		cmd.visitFlags(func(f *flag.Flag) {
+			flags = append(flags, shellQuote(zshEscape("-"+f.Name)+":"+oneLine(f.Usage)))
+		})
+		cases += fmt.Sprintf("\t%q)\n", here)
+		cases += fmt.Sprintf("\t\tcmds=(%s)\n", strings.Join(cmds, " "))
+		cases += fmt.Sprintf("\t\tflags=(%s)\n", strings.Join(flags, " "))
+		cases += "\t\t;;\n"
+	})
+
+	script := fmt.Sprintf("#compdef %s\n", progName)
+	script += fmt.Sprintf("%s() {\n", fn)
+	script += "\tlocal cmdpath w\n"
+	script += "\tlocal -a cmds flags\n"
+	script += fmt.Sprintf("\tcmdpath=%q\n", progName)
+	script += "\tfor w in \"${(@)words[2,CURRENT-1]}\"; do\n"
+	script += "\t\tcase \"$cmdpath $w\" in\n"
+	script += transitions
+	script += "\t\tesac\n"
+	script += "\tdone\n"
+	script += "\tcase \"$cmdpath\" in\n"
+	script += cases
+	script += "\tesac\n"
+	script += "\t_describe -t commands 'command' cmds\n"
+	script += "\t_describe -t flags 'flag' flags\n"
+	script += "}\n"
+	script += fmt.Sprintf("compdef %s %s\n", fn, progName)
+	return script
+}
+
+// FishCompletion returns a fish completion script for the command tree
+// invoked as progName. Sub-commands are completed with their ShortDesc and
+// flags with their usage string as descriptions. Hidden commands are omitted.
+func (c CommandType) FishCompletion(progName string) string {
+	fn := "__" + shellIdent(progName) + "_path"
+	transitions := ""
+	completes := ""
+	c.completionWalk([]string{progName}, func(path []string, cmd CommandType) {
+		here := strings.Join(path, " ")
+		cond := fishQuote(fmt.Sprintf("test (%s) = %q", fn, here))
+		for _, n := range cmd.visibleSubCommandNames() {
+			sc := cmd.SubCommands[n]
+			completes += fmt.Sprintf("complete -c %s -n %s -a %s -d %s\n", progName, cond, fishQuote(n), fishQuote(oneLine(sc.ShortDesc)))
+			pats := []string{fishQuote(here + " " + n)}
+			for _, a := range sc.Aliases {
+				pats = append(pats, fishQuote(here+" "+a))
+			}
+			transitions += fmt.Sprintf("\t\tcase %s\n\t\t\tset cmdpath %s\n", strings.Join(pats, " "), fishQuote(here+" "+n))
+		}
+		cmd.visitFlags(func(f *flag.Flag) {
+			opt := "-o"
+			if len(f.Name) == 1 {
+				opt = "-s"
+			}
+			completes += fmt.Sprintf("complete -c %s -n %s %s %s -d %s\n", progName, cond, opt, fishQuote(f.Name), fishQuote(oneLine(f.Usage)))
+		})
+	})
+
+	script := fmt.Sprintf("# fish completion for %s\n", progName)
+	script += fmt.Sprintf("function %s\n", fn)
+	script += fmt.Sprintf("\tset -l cmdpath %s\n", fishQuote(progName))
+	script += "\tfor w in (commandline -opc)[2..-1]\n"
+	script += "\t\tswitch \"$cmdpath $w\"\n"
+	script += transitions
+	script += "\t\tend\n"
+	script += "\tend\n"
+	script += "\techo $cmdpath\n"
+	script += "end\n"
+	script += fmt.Sprintf("complete -c %s -f\n", progName)
+	script += completes
+	return script
+}
+
+// completionWalk calls fn for c and each of its visible descendants, in help
+// order, with the path of names leading to each, stopping at MaxDepth.
+func (c CommandType) completionWalk(path []string, fn func([]string, CommandType)) {
+	if tooDeep(path) != nil {
+		return
+	}
+	fn(path, c)
+	for _, n := range c.visibleSubCommandNames() {
+		c.SubCommands[n].completionWalk(append(path[:len(path):len(path)], n), fn)
+	}
+}
+
+// completionFlags returns the command's flag names with a leading dash.
+func (c CommandType) completionFlags() []string {
+	words := []string{}
+	c.visitFlags(func(f *flag.Flag) { words = append(words, "-"+f.Name) })
+	return words
+}
+
+var nonIdent = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// shellIdent turns name into something usable as a shell function name.
+func shellIdent(name string) string {
+	return nonIdent.ReplaceAllString(name, "_")
+}
+
+// oneLine collapses runs of whitespace, including newlines, in s to a single
+// space.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// shellQuote quotes s for use as a single word in bash or zsh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshEscape escapes the colons in a _describe item name.
+func zshEscape(s string) string {
+	return strings.ReplaceAll(s, ":", `\:`)
+}
+
+// fishQuote quotes s for use as a single word in fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
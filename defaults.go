@@ -0,0 +1,112 @@
+package commandflags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// applyDefaultsFile sets flags in Flags from the values in DefaultsFile, if
+// it is set and exists, and records the flags it sets in sources. Flags whose
+// values set records as already set, by a command before this one on the
+// command line, are left alone.
+func (c CommandType) applyDefaultsFile(sources map[string]FlagSource, set map[flag.Value]FlagSource) error {
+	if c.DefaultsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.DefaultsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	values, err := parseDefaults(data)
+	if err != nil {
+		return fmt.Errorf(MsgDefaultsFile, c.DefaultsFile, err)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := c.Flags.Lookup(name)
+		if f == nil || isBuiltinFlag(f) {
+			if c.StrictDefaultsFile {
+				return fmt.Errorf(MsgDefaultsUnknownFlag, c.DefaultsFile, name)
+			}
+			continue
+		}
+		if setFrom(f, set) != SourceDefault {
+			continue
+		}
+		for _, v := range values[name] {
+			if err := c.Flags.Set(name, v); err != nil {
+				return fmt.Errorf(MsgDefaultsInvalidValue, c.DefaultsFile, v, name, err)
+			}
+		}
+		sources[name] = SourceFile
+	}
+	return nil
+}
+
+// parseDefaults parses the contents of a defaults file, either a JSON object
+// or lines of name=value, into the values for each flag name.
+func parseDefaults(data []byte) (map[string][]string, error) {
+	values := map[string][]string{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var obj map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.UseNumber() // keep numbers as written, e.g. 10000000, not 1e+07
+		if err := dec.Decode(&obj); err != nil {
+			return nil, err
+		}
+		for name, v := range obj {
+			if list, ok := v.([]interface{}); ok {
+				for _, e := range list {
+					values[name] = append(values[name], jsonText(e))
+				}
+				continue
+			}
+			values[name] = []string{jsonText(v)}
+		}
+		return values, nil
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		name, v, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf(MsgDefaultsSyntax, line)
+		}
+		name = strings.TrimSpace(name)
+		values[name] = append(values[name], strings.TrimSpace(v))
+	}
+	return values, sc.Err()
+}
+
+// jsonText returns the text of a JSON value decoded with UseNumber for use as
+// a flag value.
+func jsonText(v interface{}) string {
+	switch v := v.(type) {
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,58 @@
+package commandflags
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// envVar returns the name of the environment variable that flag name falls
+// back to, or "" if it has none. An entry in EnvVars takes precedence over
+// the name derived from EnvPrefix, which is the prefix and the flag name,
+// upper-cased and with dashes replaced by underscores, joined by an
+// underscore, e.g. MYTOOL_DRY_RUN for -dry-run.
+func (c CommandType) envVar(name string) string {
+	if v, ok := c.EnvVars[name]; ok {
+		return v
+	}
+	if c.EnvPrefix == "" {
+		return ""
+	}
+	return c.EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets each flag in Flags that was not set on the command line,
+// according to sources, or from the environment or command line before, as
+// recorded in set, from its environment variable, if that is present, and
+// records it in sources. The help and version flags added by ProcessArgs are
+// never set from the environment.
+func (c CommandType) applyEnv(sources map[string]FlagSource, set map[flag.Value]FlagSource) error {
+	var err error
+	c.Flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || isBuiltinFlag(f) || sources[f.Name] == SourceCommandLine || setFrom(f, set) >= SourceEnv {
+			return
+		}
+		env := c.envVar(f.Name)
+		if env == "" {
+			return
+		}
+		if v, ok := os.LookupEnv(env); ok {
+			if e := c.Flags.Set(f.Name, v); e != nil {
+				err = fmt.Errorf(MsgEnvValue, v, f.Name, env, e)
+			}
+			sources[f.Name] = SourceEnv
+		}
+	})
+	return err
+}
+
+// setFrom returns the source set records for the value of f, or
+// SourceDefault if it has none.
+func setFrom(f *flag.Flag, set map[flag.Value]FlagSource) FlagSource {
+	if !reflect.TypeOf(f.Value).Comparable() {
+		return SourceDefault
+	}
+	return set[f.Value]
+}
@@ -42,6 +42,7 @@ func init() {
 
 	cf = commandflags.NewCommandType("example", flags)
 	cf.ShortDesc = `This example demonstrates commandflags.`
+	cf.Version = "example 1.0"
 	cf.LongDesc = `This example demonstrates commandflags. The commandflags
 	library is designed to be a minimal add-on for the built-in flags library to
 	add subcommands. Each subcommand may have it's own flag set, or share a
@@ -52,7 +53,7 @@ func init() {
 		"help": commandflags.CommandType{
 			Name:      "help",
 			ShortDesc: "Show help for a command",
-			LongDesc:  "Help usage:  help COMMAND",
+			LongDesc:  "Help usage:  help [COMMAND...]",
 			Help:      "Valid commands are deploy, create, update, show, list_artifacts, and deployments",
 		},
 		"deploy": commandflags.CommandType{
@@ -60,18 +61,28 @@ func init() {
 			Flags:     flags,
 			ShortDesc: "deploy an app completely",
 			LongDesc:  "usage: deploy NAME REV",
+			MinArgs:   2,
+			MaxArgs:   2,
+			ArgNames:  []string{"NAME", "REV"},
+			Examples: []commandflags.Example{
+				{Command: "example deploy -i 3 myapp 1.2", Description: "deploy revision 1.2 of myapp as three instances"},
+			},
 		},
 		"create": commandflags.CommandType{
 			Name:      "create",
 			Flags:     flags,
 			ShortDesc: "initial create/deploy of an app",
 			LongDesc:  "usage: create NAME REV",
+			MinArgs:   2,
+			MaxArgs:   2,
 		},
 		"update": commandflags.CommandType{
 			Name:      "update",
 			Flags:     flags,
 			ShortDesc: "update definition of an app, really!",
 			LongDesc:  "usage: update NAME REV",
+			MinArgs:   2,
+			MaxArgs:   2,
 		},
 		"show": commandflags.CommandType{
 			Name:      "show",
@@ -100,11 +111,19 @@ func init() {
 
 func main() {
 	var words []string
-	var err error
+	var err commandflags.Error
 
 	if words, err = cf.ProcessArgs(os.Args[1:]); err != nil {
+		switch err.(type) {
+		case commandflags.VersionRequestedError:
+			fmt.Println(err)
+			os.Exit(0)
+		case commandflags.HelpRequestedError:
+			fmt.Print(err)
+			os.Exit(0)
+		}
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(commandflags.ExitCode(err))
 	}
 
 	fmt.Println("all the nonflags are: ", words)
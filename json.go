@@ -0,0 +1,136 @@
+package commandflags
+
+import (
+	"encoding/json"
+	"flag"
+)
+
+// errorJSON is the JSON representation of an Error.
+type errorJSON struct {
+	Error   string   `json:"error"` // the message, without any help
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Kind    string   `json:"kind"` // the type of error, e.g. invalid_command
+}
+
+// marshalError encodes e, a UsageError or an error embedding it, as JSON
+// with the given kind.
+func marshalError(e UsageError, kind string) ([]byte, error) {
+	j := errorJSON{Error: e.e, Args: e.a, Kind: kind}
+	if e.m != "" {
+		j.Error = e.m
+	}
+	if e.c != nil {
+		j.Command = e.c.Name
+	}
+	if j.Args == nil {
+		j.Args = []string{}
+	}
+	return json.Marshal(j)
+}
+
+// MarshalJSON encodes the error as a JSON object for programs to consume,
+// such as a tool whose output is JSON, e.g.
+//
+//	{"error":"Invalid COMMAND: foo","command":"example","args":["foo"],"kind":"invalid_command"}
+//
+// The error field holds the message without the command's help, and the kind
+// field names the type of error: usage, missing_command, invalid_command,
+// flag, arg_count, version_requested, help_requested or run.
+func (e UsageError) MarshalJSON() ([]byte, error) { return marshalError(e, "usage") }
+
+// MarshalJSON encodes the error as JSON, as for UsageError.
+func (e MissingCommandError) MarshalJSON() ([]byte, error) {
+	return marshalError(e.UsageError, "missing_command")
+}
+
+// MarshalJSON encodes the error as JSON, as for UsageError.
+func (e InvalidCommandError) MarshalJSON() ([]byte, error) {
+	return marshalError(e.UsageError, "invalid_command")
+}
+
+// MarshalJSON encodes the error as JSON, as for UsageError.
+func (e FlagError) MarshalJSON() ([]byte, error) { return marshalError(e.UsageError, "flag") }
+
+// MarshalJSON encodes the error as JSON, as for UsageError.
+func (e ArgCountError) MarshalJSON() ([]byte, error) {
+	return marshalError(e.UsageError, "arg_count")
+}
+
+// MarshalJSON encodes the error as JSON, as for UsageError.
+func (e VersionRequestedError) MarshalJSON() ([]byte, error) {
+	return marshalError(e.UsageError, "version_requested")
+}
+
+// MarshalJSON encodes the error as JSON, as for UsageError.
+func (e HelpRequestedError) MarshalJSON() ([]byte, error) {
+	return marshalError(e.UsageError, "help_requested")
+}
+
+// MarshalJSON encodes the error as JSON, as for UsageError.
+func (e RunError) MarshalJSON() ([]byte, error) { return marshalError(e.UsageError, "run") }
+
+// commandJSON is the JSON representation of a CommandType.
+type commandJSON struct {
+	Name        string        `json:"name"`
+	Aliases     []string      `json:"aliases,omitempty"`
+	Hidden      bool          `json:"hidden,omitempty"`
+	ShortDesc   string        `json:"short_desc,omitempty"`
+	LongDesc    string        `json:"long_desc,omitempty"`
+	Help        string        `json:"help,omitempty"`
+	Flags       []flagJSON    `json:"flags,omitempty"`
+	SubCommands []commandJSON `json:"sub_commands,omitempty"`
+}
+
+// flagJSON is the JSON representation of a flag.
+type flagJSON struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // BOOL, UINT, INT, STRING, FLOAT or VALUE
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// MarshalJSON encodes the command and its sub-commands, in help order, as
+// JSON. Each command includes its name, descriptions, help text and flags,
+// with the flag type given by the same label used in help, or BOOL for
+// boolean flags. This is intended for documentation generators and other
+// tools that need to introspect the command tree. A tree deeper than MaxDepth
+// results in an error.
+func (c CommandType) MarshalJSON() ([]byte, error) {
+	j, err := c.toJSON([]string{c.Name})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+// toJSON returns the JSON representation of c, reached by path.
+func (c CommandType) toJSON(path []string) (commandJSON, error) {
+	if err := tooDeep(path); err != nil {
+		return commandJSON{}, err
+	}
+	j := commandJSON{
+		Name:      c.Name,
+		Aliases:   c.Aliases,
+		Hidden:    c.Hidden,
+		ShortDesc: c.ShortDesc,
+		LongDesc:  c.LongDesc,
+		Help:      c.Help,
+	}
+	c.visitFlags(func(f *flag.Flag) {
+		j.Flags = append(j.Flags, flagJSON{
+			Name:    f.Name,
+			Type:    flagKind(f),
+			Default: f.DefValue,
+			Usage:   f.Usage,
+		})
+	})
+	for _, n := range c.subCommandNames() {
+		sc, err := c.SubCommands[n].toJSON(append(path[:len(path):len(path)], n))
+		if err != nil {
+			return commandJSON{}, err
+		}
+		j.SubCommands = append(j.SubCommands, sc)
+	}
+	return j, nil
+}
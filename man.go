@@ -0,0 +1,115 @@
+package commandflags
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// ManPage returns the command's documentation as man(7) source for the given
+// manual section. The page has a NAME section built from Name and ShortDesc,
+// a SYNOPSIS, a DESCRIPTION from LongDesc, OPTIONS from the flags, COMMANDS
+// listing the visible sub-commands, NOTES from Help, and a SEE ALSO section
+// that refers to a page for each sub-command named NAME-SUBCOMMAND, as
+// generated by ManPages.
+func (c CommandType) ManPage(section int) string {
+	return c.manPage([]string{c.Name}, section)
+}
+
+// ManPages returns a man page, as made by ManPage, for the command and each
+// of its visible descendants, keyed by the page's name: the names of the
+// commands from c to it joined by dashes, e.g. "example-deployments-status".
+// These are the names the SEE ALSO sections refer to, so the pages may be
+// written to files such as example-deployments-status.1. A tree deeper than
+// MaxDepth is cut off at that depth.
+func (c CommandType) ManPages(section int) map[string]string {
+	pages := map[string]string{}
+	c.Walk(func(path []string, cmd CommandType) error {
+		if cmd.Hidden && len(path) > 1 {
+			return SkipSubCommands
+		}
+		pages[strings.Join(path, "-")] = cmd.manPage(path, section)
+		return nil
+	})
+	return pages
+}
+
+// manPage implements ManPage for c, reached from the root of the pages by
+// path.
+func (c CommandType) manPage(path []string, section int) string {
+	name := strings.Join(path, "-")
+	page := fmt.Sprintf(".TH %s %d\n", roffEscape(strings.ToUpper(name)), section)
+
+	page += ".SH NAME\n"
+	if c.ShortDesc != "" {
+		page += fmt.Sprintf("%s \\- %s\n", roffEscape(name), roffEscape(oneLine(c.ShortDesc)))
+	} else {
+		page += roffEscape(name) + "\n"
+	}
+
+	page += ".SH SYNOPSIS\n"
+	page += fmt.Sprintf(".B %s\n", roffEscape(strings.Join(path, " ")))
+	if c.hasFlags() {
+		page += "[\\fIOPTIONS\\fR]\n"
+	}
+	if len(c.SubCommands) > 0 {
+		page += "\\fICOMMAND\\fR\n"
+	} else {
+		page += "[\\fIARGS\\fR...]\n"
+	}
+
+	if desc := c.LongDesc; desc != "" || c.ShortDesc != "" {
+		if desc == "" {
+			desc = c.ShortDesc
+		}
+		page += ".SH DESCRIPTION\n"
+		page += roffEscape(oneLine(desc)) + "\n"
+	}
+
+	options := ""
+	c.visitFlags(func(f *flag.Flag) {
+		options += ".TP\n"
+		options += fmt.Sprintf(".B \\-%s", roffEscape(f.Name))
+		if label := c.flagLabel(f); label != "" {
+			options += fmt.Sprintf("%s\\fI%s\\fR", roffEscape(FlagValueSeparator), label)
+		}
+		options += "\n" + roffEscape(oneLine(f.Usage)) + "\n"
+	})
+	if options != "" {
+		page += ".SH OPTIONS\n" + options
+	}
+
+	names := c.visibleSubCommandNames()
+	if len(names) > 0 {
+		page += ".SH COMMANDS\n"
+		for _, n := range names {
+			page += ".TP\n"
+			page += fmt.Sprintf(".B %s\n", roffEscape(c.SubCommands[n].displayName()))
+			page += roffEscape(oneLine(c.SubCommands[n].ShortDesc)) + "\n"
+		}
+	}
+
+	if c.Help != "" {
+		page += ".SH NOTES\n"
+		page += roffEscape(oneLine(c.Help)) + "\n"
+	}
+
+	if len(names) > 0 {
+		page += ".SH SEE ALSO\n"
+		refs := []string{}
+		for _, n := range names {
+			refs = append(refs, fmt.Sprintf(".BR %s (%d)", roffEscape(name+"-"+n), section))
+		}
+		page += strings.Join(refs, ",\n") + "\n"
+	}
+	return page
+}
+
+// roffEscape escapes s for use as text in a man page.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
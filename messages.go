@@ -0,0 +1,56 @@
+package commandflags
+
+// The messages below are the text commandflags shows to users in errors,
+// notices and help. They may be replaced, for example with translations,
+// before any command is processed. Each replacement must take the same
+// arguments, in the same order, as the message it replaces.
+var (
+	// usage errors returned by ProcessArgs
+	MsgMissingCommand   = "Missing COMMAND:"
+	MsgInvalidCommand   = "Invalid COMMAND: %s"            // the name given
+	MsgInvalidCommandAt = "At '%s': Invalid COMMAND: %s"   // the path, the name given
+	MsgAmbiguousCommand = "Ambiguous COMMAND '%s': %s"     // the prefix, the matches in order
+	MsgDidYouMean       = "Did you mean %q?"               // the suggestion
+	MsgFlagNotCommand   = "Expected COMMAND, not flag: %s" // the token given
+	MsgMissingFlags     = "Missing required flags: %s"     // the flags
+	MsgConflictingFlags = "Conflicting flags: %s"          // the groups of flags
+	MsgArgCount         = "Expected %s arguments, got %d"  // one of MsgArgs*, the count
+	MsgMissingArgument  = "%s: missing argument %s"        // the command, the ArgNames entry
+	MsgTooDeep          = "%s: command tree is deeper than MaxDepth (%d)"
+	MsgHelpRequested    = "help requested"
+	MsgBundledFlag      = "-%c in %s is not a single-letter boolean flag"   // the letter, the token
+	MsgFlagAliasTwice   = "-%s and -%s are the same flag; give only -%[2]s" // the old name, the new name
+
+	// the accepted number of arguments in MsgArgCount
+	MsgArgsAtLeast = "at least %d"
+	MsgArgsExactly = "exactly %d"
+	MsgArgsAtMost  = "at most %d"
+	MsgArgsRange   = "%d to %d"
+
+	// bad flag values from the environment or DefaultsFile
+	MsgEnvValue             = "invalid value %q for flag -%s from $%s: %v"
+	MsgDefaultsFile         = "%s: %v" // the file name, the error
+	MsgDefaultsSyntax       = "line %d: expected name=value"
+	MsgDefaultsUnknownFlag  = "%s: flag provided but not defined: -%s"
+	MsgDefaultsInvalidValue = "%s: invalid value %q for flag -%s: %v"
+
+	// bad response files
+	MsgResponseFile = "%s: %v" // the file name, the error
+
+	// deprecation notices
+	MsgCommandDeprecated     = "Command %s is deprecated: %s" // the name, Deprecated
+	MsgFlagDeprecated        = "Flag -%s is deprecated"
+	MsgFlagDeprecatedBecause = "Flag -%s is deprecated: %s"      // the name, the message
+	MsgFlagRenamed           = "Flag -%s is deprecated: use -%s" // the old name, the new name
+
+	// help
+	MsgSynopsis             = "Usage: %s" // the Synopsis
+	MsgHelpFlagUsage        = "Print help and exit"
+	MsgVersionFlagUsage     = "Print version and exit"
+	MsgRepeatableAnnotation = "(may be repeated)"
+	MsgDeprecatedAnnotation = "(deprecated)"
+	MsgDefaultAnnotation    = "(default %s)" // the default, quoted for strings
+
+	// REPL
+	MsgUnterminatedQuote = "unterminated quote or escape"
+)
@@ -0,0 +1,68 @@
+package commandflags
+
+import (
+	"fmt"
+	"io"
+)
+
+// A HelpOption changes how FormatHelp renders a command's help.
+type HelpOption func(*helpOptions)
+
+// helpOptions holds the settings made by HelpOptions.
+type helpOptions struct {
+	width  int       // 0 for the default
+	color  *bool     // nil for the default
+	w      io.Writer // nil for none
+	indent int       // 0 for the default
+}
+
+// WithWidth wraps help to width columns.
+func WithWidth(width int) HelpOption {
+	return func(o *helpOptions) { o.width = width }
+}
+
+// WithColor enables or disables ANSI colors in help, regardless of Color,
+// NO_COLOR or whether the help is written to a terminal.
+func WithColor(color bool) HelpOption {
+	return func(o *helpOptions) { o.color = &color }
+}
+
+// WithWriter writes help to w as well as returning it. Unless set by other
+// options, the width and coloring are chosen for w as by PrintHelp.
+func WithWriter(w io.Writer) HelpOption {
+	return func(o *helpOptions) { o.w = w }
+}
+
+// WithIndent indents help by indent spaces, in place of the command's Indent
+// or HelpIndent.
+func WithIndent(indent int) HelpOption {
+	return func(o *helpOptions) { o.indent = indent }
+}
+
+// FormatHelp returns the command's help rendered according to opts. With no
+// options it is the same as RenderHelp for the command's Width, or
+// DefaultWidth.
+func (c CommandType) FormatHelp(opts ...HelpOption) string {
+	o := helpOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.indent != 0 {
+		c.Indent = o.indent
+	}
+	width := o.width
+	if width == 0 && o.w != nil {
+		width = c.termWidth(o.w)
+	} else if width == 0 {
+		width = c.helpWidth()
+	}
+	color := colorEnabled(o.w)
+	if o.color != nil {
+		color = *o.color
+	}
+	help := c.render(width, color)
+	if o.w != nil {
+		fmt.Fprint(o.w, help)
+	}
+	return help
+}
@@ -0,0 +1,89 @@
+package commandflags
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// REPLPrompt is written before each line read by REPL.
+var REPLPrompt = "> "
+
+// REPL runs an interactive session on the command tree: it reads lines from
+// r, splits each into arguments as a shell would, honouring single and
+// double quotes and backslash escapes, and processes them as with
+// ProcessArgs, so that the resolved command's Run handler is called. Errors,
+// including usage errors with their help, are written to w and the session
+// continues. A line consisting of exit or quit ends the session, unless the
+// command has a sub-command of that name, as does the end of r. REPL returns
+// an error only if reading r fails.
+func (c *CommandType) REPL(r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, REPLPrompt)
+		if !sc.Scan() {
+			fmt.Fprintln(w)
+			return sc.Err()
+		}
+		args, err := splitLine(sc.Text())
+		if err != nil {
+			fmt.Fprintln(w, err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if _, ok := c.lookupSubCommand(args[0]); !ok && len(args) == 1 && (args[0] == "exit" || args[0] == "quit") {
+			return nil
+		}
+		if _, err := c.ProcessArgs(args); err != nil {
+			fmt.Fprintln(w, strings.TrimRight(err.Error(), "\n"))
+		}
+	}
+}
+
+// splitLine splits line into words at unquoted white space. Within single
+// quotes all characters are literal; within double quotes and unquoted, a
+// backslash escapes the character that follows it.
+func splitLine(line string) ([]string, error) {
+	words := []string{}
+	word := strings.Builder{}
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'' && r != '\'':
+			word.WriteRune(r)
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New(MsgUnterminatedQuote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,38 @@
+package commandflags
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandResponseFiles returns a copy of args in which each argument of the
+// form @path, up to any "--", is replaced by the arguments read from the
+// file at path, and each argument starting with @@ has its first @ removed.
+// The file is split into arguments as by splitLine, so arguments may be
+// separated by any white space, including newlines, and quoted. Arguments
+// read from a file are not expanded further.
+func expandResponseFiles(args []string) ([]string, error) {
+	out := make([]string, 0, len(args))
+	for i, s := range args {
+		switch {
+		case s == "--":
+			return append(out, args[i:]...), nil
+		case strings.HasPrefix(s, "@@"):
+			out = append(out, s[1:])
+		case strings.HasPrefix(s, "@") && len(s) > 1:
+			data, err := os.ReadFile(s[1:])
+			if err != nil {
+				return nil, err
+			}
+			words, err := splitLine(string(data))
+			if err != nil {
+				return nil, fmt.Errorf(MsgResponseFile, s[1:], err)
+			}
+			out = append(out, words...)
+		default:
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
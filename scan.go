@@ -0,0 +1,202 @@
+package commandflags
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// scanFlags walks args the way fs.Parse does and returns the number of
+// leading args that are flags or flag values, and whether they were ended by
+// a "--" terminator, which is included in n. Unknown flags are assumed to
+// take no separate value.
+func scanFlags(fs *flag.FlagSet, args []string) (n int, terminated bool) {
+	return walkFlags(fs, args, func(string) {})
+}
+
+// commandLineFlags returns the names of the flags defined in fs that are set
+// by args, regardless of any values the flags were given by other means.
+func commandLineFlags(fs *flag.FlagSet, args []string) map[string]bool {
+	names := map[string]bool{}
+	walkFlags(fs, args, func(name string) {
+		if fs.Lookup(name) != nil {
+			names[name] = true
+		}
+	})
+	return names
+}
+
+// walkFlags implements scanFlags, calling fn with the name of each flag
+// found.
+func walkFlags(fs *flag.FlagSet, args []string, fn func(name string)) (n int, terminated bool) {
+	for n < len(args) {
+		s := args[n]
+		if len(s) < 2 || s[0] != '-' {
+			return n, false
+		}
+		n++
+		if s == "--" {
+			return n, true
+		}
+		name := strings.TrimPrefix(s[1:], "-")
+		if i := strings.Index(name, "="); i >= 0 {
+			fn(name[:i])
+			continue
+		}
+		fn(name)
+		if f := fs.Lookup(name); f != nil && !isBoolValue(f.Value) && n < len(args) {
+			n++ // the flag's value
+		}
+	}
+	return n, false
+}
+
+// splitUnknownFlags separates the leading flags in args that are not defined
+// in fs from the rest, keeping the order of each. Like scanFlags, it assumes
+// that unknown flags take no separate value.
+func splitUnknownFlags(fs *flag.FlagSet, args []string) (known, unknown []string) {
+	n := 0
+	for n < len(args) {
+		s := args[n]
+		if len(s) < 2 || s[0] != '-' || s == "--" {
+			break
+		}
+		n++
+		name := strings.TrimPrefix(s[1:], "-")
+		value := strings.Contains(name, "=")
+		if value {
+			name = name[:strings.Index(name, "=")]
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			unknown = append(unknown, s)
+			continue
+		}
+		known = append(known, s)
+		if !value && !isBoolValue(f.Value) && n < len(args) {
+			known = append(known, args[n]) // the flag's value
+			n++
+		}
+	}
+	return append(known, args[n:]...), unknown
+}
+
+// normalizeFlags returns a copy of args in which the names of the leading
+// flags are replaced by the name of the flag in fs they match once both are
+// passed through normalize. Names matching a flag exactly, and names
+// matching none, are left as they are.
+func normalizeFlags(fs *flag.FlagSet, args []string, normalize func(string) string) []string {
+	names := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		n := normalize(f.Name)
+		if _, ok := names[n]; !ok {
+			names[n] = f.Name // VisitAll is in lexical order, so the first wins
+		}
+	})
+	out := append([]string(nil), args...)
+	n := 0
+	for n < len(out) {
+		s := out[n]
+		if len(s) < 2 || s[0] != '-' || s == "--" {
+			break
+		}
+		n++
+		dashes := "-"
+		if strings.HasPrefix(s, "--") {
+			dashes = "--"
+		}
+		name, value := s[len(dashes):], ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = name[:i], name[i:]
+		}
+		if fs.Lookup(name) == nil {
+			if canonical, ok := names[normalize(name)]; ok {
+				name = canonical
+				out[n-1] = dashes + name + value
+			}
+		}
+		if f := fs.Lookup(name); f != nil && value == "" && !isBoolValue(f.Value) && n < len(out) {
+			n++ // the flag's value
+		}
+	}
+	return out
+}
+
+// renameFlags returns a copy of args in which the names of the leading flags
+// that are keys of aliases and not defined in fs are replaced by their values,
+// along with the old names replaced, in order. It returns an error if both
+// the old and new names of a flag are given.
+func renameFlags(fs *flag.FlagSet, args []string, aliases map[string]string) (out, renamed []string, err error) {
+	out = append([]string(nil), args...)
+	given := map[string]bool{}
+	n := 0
+	for n < len(out) {
+		s := out[n]
+		if len(s) < 2 || s[0] != '-' || s == "--" {
+			break
+		}
+		n++
+		dashes := "-"
+		if strings.HasPrefix(s, "--") {
+			dashes = "--"
+		}
+		name, value := s[len(dashes):], ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = name[:i], name[i:]
+		}
+		if to, ok := aliases[name]; ok && fs.Lookup(name) == nil {
+			renamed = append(renamed, name)
+			name = to
+			out[n-1] = dashes + name + value
+		} else {
+			given[name] = true
+		}
+		if f := fs.Lookup(name); f != nil && value == "" && !isBoolValue(f.Value) && n < len(out) {
+			n++ // the flag's value
+		}
+	}
+	for _, old := range renamed {
+		if given[aliases[old]] {
+			return nil, nil, fmt.Errorf(MsgFlagAliasTwice, old, aliases[old])
+		}
+	}
+	return out, renamed, nil
+}
+
+// expandBundledFlags returns a copy of args in which each of the leading
+// flags that is a single dash followed by several single-letter boolean
+// flags of fs, such as -vd, is replaced by those flags, -v -d. It returns an
+// error for such a token containing a letter that is not one.
+func expandBundledFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	out := []string{}
+	n := 0
+	for n < len(args) {
+		s := args[n]
+		if len(s) < 2 || s[0] != '-' || s == "--" {
+			break
+		}
+		n++
+		name := s[1:]
+		if f := fs.Lookup(name); f != nil || strings.HasPrefix(name, "-") || strings.Contains(name, "=") {
+			out = append(out, s)
+			if f != nil && !isBoolValue(f.Value) && n < len(args) {
+				out = append(out, args[n]) // the flag's value
+				n++
+			}
+			continue
+		}
+		for _, r := range name {
+			if f := fs.Lookup(string(r)); f == nil || !isBoolValue(f.Value) {
+				return nil, fmt.Errorf(MsgBundledFlag, r, s)
+			}
+			out = append(out, "-"+string(r))
+		}
+	}
+	return append(out, args[n:]...), nil
+}
+
+// isBoolValue reports whether v is a flag value that takes no argument.
+func isBoolValue(v flag.Value) bool {
+	b, ok := v.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
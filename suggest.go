@@ -0,0 +1,48 @@
+package commandflags
+
+// SuggestDistance is the largest edit distance between a mistyped sub-command
+// and a valid name or alias for the name to be suggested in the error.
+var SuggestDistance = 2
+
+// suggest returns the visible sub-command name or alias closest to name, or
+// "" if none is within SuggestDistance edits.
+func (c CommandType) suggest(name string) string {
+	best, bestDist := "", SuggestDistance+1
+	for _, n := range c.visibleSubCommandNames() {
+		for _, candidate := range append([]string{n}, c.SubCommands[n].Aliases...) {
+			if d := levenshtein(name, candidate); d < bestDist {
+				best, bestDist = candidate, d
+			}
+		}
+	}
+	return best
+}
+
+// levenshtein returns the number of single character insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur := make([]int, len(t)+1)
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev = cur
+	}
+	return prev[len(t)]
+}
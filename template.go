@@ -0,0 +1,253 @@
+package commandflags
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/jagipson/refmt"
+)
+
+// DefaultHelpTemplate is the built-in help layout as a HelpTemplate, for
+// use as a starting point for one's own. It must be parsed with HelpFuncs:
+//
+//	tmpl := template.Must(template.New("help").Funcs(commandflags.HelpFuncs).Parse(commandflags.DefaultHelpTemplate))
+//
+// Its output is that of the built-in layout, except that it is never
+// colored and is wrapped with refmt's default Style rather than Style.
+const DefaultHelpTemplate = `{{.Header}}
+{{- with .Tagline}}{{wrap $.Indent $.Width .}}{{"\n\n"}}{{end}}
+{{- with .Usage}}{{indent $.Indent .}}{{"\n\n"}}{{end}}
+{{- with .Description}}{{wrap $.Indent $.Width .}}{{"\n\n"}}{{end}}
+{{- range $i, $s := .FlagSections}}{{if $i}}{{"\n"}}{{end}}
+{{- indent $.Indent $s.Title}}{{"\n"}}
+{{- range $s.Flags}}{{if .Wide}}{{indent $.Indent .Column}}{{"\n"}}{{wrap $.FlagColumn $.Width .Usage}}
+{{- else}}{{pad $.FlagColumn (indent $.Indent .Column)}}{{wrap2 $.FlagColumn $.Width .Usage}}{{end}}{{"\n"}}
+{{- end}}{{end}}
+{{- range .SubCommandSections}}{{"\n"}}{{indent $.Indent .Title}}{{"\n"}}
+{{- range .SubCommands}}{{indent $.Indent (pad $.SubCommandColumn .DisplayName)}}  {{wrap2 (add $.Indent $.SubCommandColumn 2) $.Width .Summary}}{{"\n"}}
+{{- end}}{{end}}
+{{- with .Examples}}{{"\n"}}{{indent $.Indent $.ExamplesTitle}}{{"\n"}}
+{{- range .}}{{indent (mul $.Indent 2) .Command}}{{"\n"}}
+{{- with .Description}}{{wrap (mul $.Indent 3) $.Width .}}{{"\n"}}{{end}}
+{{- end}}{{end}}
+{{- with .Help}}{{if or $.FlagSections $.SubCommandSections $.Examples (not (or $.Description $.Usage))}}{{"\n"}}{{end}}
+{{- wrap $.Indent $.Width .}}{{"\n"}}{{end}}`
+
+// HelpFuncs are the functions DefaultHelpTemplate uses, which other help
+// templates may use too:
+//
+//	wrap INDENT WIDTH TEXT   TEXT wrapped to WIDTH columns, every line indented by INDENT
+//	wrap2 INDENT WIDTH TEXT  the same, but with the first line not indented
+//	indent N TEXT            TEXT preceded by N spaces
+//	pad N TEXT               TEXT followed by spaces to make it N runes long
+//	add N...                 the sum of the numbers
+//	mul N...                 the product of the numbers
+var HelpFuncs = template.FuncMap{
+	"wrap": func(indent, width int, s string) string {
+		style := helpStyle(indent, width)
+		return style.Indent(style.Wrap(s))
+	},
+	"wrap2": func(indent, width int, s string) string {
+		style := helpStyle(indent, width)
+		return style.Indent2(style.Wrap(s))
+	},
+	"indent": func(n int, s string) string { return fmt.Sprintf("%*s%s", n, "", s) },
+	"pad":    func(n int, s string) string { return fmt.Sprintf("%-*s", n, s) },
+	"add": func(n ...int) int {
+		sum := 0
+		for _, i := range n {
+			sum += i
+		}
+		return sum
+	},
+	"mul": func(n ...int) int {
+		product := 1
+		for _, i := range n {
+			product *= i
+		}
+		return product
+	},
+}
+
+// helpStyle returns a refmt.Style that wraps text to width columns, of which
+// the first indent are the indent.
+func helpStyle(indent, width int) *refmt.Style {
+	style := refmt.NewStyle()
+	style.IndentWidth = indent
+	style.MaxWidth = wrapWidth(width, indent)
+	return style
+}
+
+// HelpData is the view of a command passed to a HelpTemplate.
+type HelpData struct {
+	Name       string // Name of the command
+	ShortDesc  string
+	LongDesc   string
+	Help       string
+	Synopsis   string // as returned by Synopsis
+	Deprecated string // the command's Deprecated message, if any
+	Width      int    // the width help is to be wrapped to
+	Indent     int    // the indent in effect for the command
+
+	// Header, Tagline, Usage and Description are the blocks at the top of
+	// the built-in layout, each "" if it is not shown: the heading from
+	// HelpHeaderFormat, the ShortDesc if ShowTagline applies, the synopsis
+	// line if ShowSynopsis is set, and the LongDesc, or else ShortDesc.
+	Header      string
+	Tagline     string
+	Usage       string
+	Description string
+
+	// FlagSections lists the flags under their headings: the FlagGroups,
+	// followed by the flags in no group under FlagsSectionLabel and then
+	// the inherited flags in no group under GlobalFlagsSectionLabel.
+	FlagSections []HelpFlagSection
+
+	// FlagColumn is the width of the flag column in the built-in layout,
+	// including the indent and the gap before each flag's usage.
+	FlagColumn int
+
+	// SubCommands lists the visible sub-commands in help order.
+	SubCommands []HelpSubCommand
+
+	// SubCommandSections lists the visible sub-commands under their
+	// headings: the SubCommandGroups, followed by the sub-commands in no
+	// group under SubCommandsSectionLabel.
+	SubCommandSections []HelpSubCommandSection
+
+	// SubCommandColumn is the width of the widest DisplayName of the
+	// visible sub-commands.
+	SubCommandColumn int
+
+	Examples      []Example // the command's Examples
+	ExamplesTitle string    // ExamplesSectionLabel
+}
+
+// HelpFlagSection is a heading and the flags listed beneath it in help.
+type HelpFlagSection struct {
+	Title string
+	Flags []HelpFlag
+}
+
+// HelpFlag describes a flag for a HelpTemplate.
+type HelpFlag struct {
+	Name       string // without the leading dash
+	Short      string // the short name paired with Name by AliasFlag, if any
+	Label      string // placeholder for the value, or "" for boolean flags
+	Usage      string // usage as shown in help, with its default and notes
+	Default    string
+	Deprecated bool
+	Column     string // names and label as in the flag column, e.g. "-c, -cpu FLOAT"
+	Wide       bool   // whether Column is too wide for MaxFlagColWidth
+}
+
+// HelpSubCommand describes a sub-command for a HelpTemplate.
+type HelpSubCommand struct {
+	Name        string
+	Aliases     []string
+	ShortDesc   string
+	Deprecated  bool
+	DisplayName string // Name followed by any Aliases, as in help
+	Summary     string // ShortDesc as in help, marked if Deprecated
+}
+
+// HelpSubCommandSection is a heading and the sub-commands listed beneath it
+// in help.
+type HelpSubCommandSection struct {
+	Title       string
+	SubCommands []HelpSubCommand
+}
+
+// helpData returns the HelpData for c wrapped to width.
+func (c CommandType) helpData(width int) HelpData {
+	d := HelpData{
+		Name:       c.Name,
+		ShortDesc:  c.ShortDesc,
+		LongDesc:   c.LongDesc,
+		Help:       c.Help,
+		Synopsis:   c.Synopsis(),
+		Deprecated: c.Deprecated,
+		Width:      width,
+		Indent:     c.helpIndent(),
+		Examples:   c.Examples,
+
+		ExamplesTitle: ExamplesSectionLabel,
+	}
+	if HelpHeaderFormat != "" {
+		d.Header = fmt.Sprintf(HelpHeaderFormat, c.Name)
+	}
+	if ShowTagline && len(c.LongDesc) > 0 {
+		d.Tagline = c.ShortDesc
+	}
+	if ShowSynopsis {
+		d.Usage = fmt.Sprintf(MsgSynopsis, d.Synopsis)
+	}
+	d.Description = c.LongDesc
+	if d.Description == "" {
+		d.Description = c.ShortDesc
+	}
+
+	flags, flagNames, flagCols, flagColWidth := c.flagColumns()
+	d.FlagColumn = flagColWidth
+	for _, s := range c.flagSections(flags) {
+		hs := HelpFlagSection{Title: s.title}
+		for _, f := range s.flags {
+			_, deprecated := c.DeprecatedFlags[f.Name]
+			hf := HelpFlag{
+				Name:       f.Name,
+				Label:      c.flagLabel(f),
+				Usage:      c.flagUsage(f),
+				Default:    f.DefValue,
+				Deprecated: deprecated,
+				Column:     strings.TrimSpace(flagCols[f.Name]),
+				Wide:       c.flagColTooWide(utf8.RuneCountInString(flagCols[f.Name])),
+			}
+			if flagNames[f.Name] != FlagPrefix+f.Name {
+				hf.Short = c.shortFlags[f.Name]
+			}
+			hs.Flags = append(hs.Flags, hf)
+		}
+		d.FlagSections = append(d.FlagSections, hs)
+	}
+
+	names := c.visibleSubCommandNames()
+	subs := map[string]HelpSubCommand{}
+	for _, n := range names {
+		sc := c.SubCommands[n]
+		summary := sc.ShortDesc
+		if sc.Deprecated != "" {
+			summary = strings.TrimSpace(summary + " " + MsgDeprecatedAnnotation)
+		}
+		subs[n] = HelpSubCommand{
+			Name:        sc.Name,
+			Aliases:     sc.Aliases,
+			ShortDesc:   sc.ShortDesc,
+			Deprecated:  sc.Deprecated != "",
+			DisplayName: sc.displayName(),
+			Summary:     summary,
+		}
+		d.SubCommands = append(d.SubCommands, subs[n])
+		if w := utf8.RuneCountInString(sc.displayName()); w > d.SubCommandColumn {
+			d.SubCommandColumn = w
+		}
+	}
+	for _, s := range c.subCommandSections(names) {
+		hs := HelpSubCommandSection{Title: s.title}
+		for _, n := range s.names {
+			hs.SubCommands = append(hs.SubCommands, subs[n])
+		}
+		d.SubCommandSections = append(d.SubCommandSections, hs)
+	}
+	return d
+}
+
+// renderTemplate renders c's help, wrapped to width, with HelpTemplate.
+func (c CommandType) renderTemplate(width int) (string, error) {
+	var b strings.Builder
+	if err := c.HelpTemplate.Execute(&b, c.helpData(width)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
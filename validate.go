@@ -0,0 +1,125 @@
+package commandflags
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Validate walks the command tree and returns every structural problem it
+// finds. It is intended to be called once at startup so that mistakes in the
+// tree are found before a user happens upon them. Each error names the full
+// command path. The problems reported are:
+//
+//   - a sub-command whose Name does not match its key in SubCommands
+//   - an alias claimed by more than one sub-command
+//   - a sub-command name or alias that is also the name of a flag
+//   - required, mutually exclusive or own flags that are not defined in Flags
+//   - a MaxArgs smaller than MinArgs
+//   - a DefaultSubCommand that does not exist
+//   - a command with both SubCommands and a Run handler, which would never
+//     be called
+//   - a command with both SubCommands and CaptureRest, whose sub-commands
+//     could never be reached
+//   - a SubCommands map that contains itself, directly or further down, or
+//     a tree deeper than MaxDepth
+func (c CommandType) Validate() []error {
+	return c.validate([]string{c.Name}, map[uintptr]bool{})
+}
+
+// validate implements Validate for c, reached by path, where ancestors holds
+// the SubCommands maps of the commands above c.
+func (c CommandType) validate(path []string, ancestors map[uintptr]bool) []error {
+	var errs []error
+	where := strings.Join(path, " ")
+
+	if err := tooDeep(path); err != nil {
+		return []error{err}
+	}
+	if c.SubCommands != nil {
+		m := reflect.ValueOf(c.SubCommands).Pointer()
+		if ancestors[m] {
+			return []error{fmt.Errorf("%s: sub-commands form a cycle", where)}
+		}
+		ancestors[m] = true
+		defer delete(ancestors, m)
+	}
+
+	if len(c.SubCommands) > 0 && (c.Run != nil || c.RunContext != nil) {
+		errs = append(errs, fmt.Errorf("%s: has both sub-commands and a Run handler", where))
+	}
+	if len(c.SubCommands) > 0 && c.CaptureRest {
+		errs = append(errs, fmt.Errorf("%s: has both sub-commands and CaptureRest", where))
+	}
+	if c.MaxArgs >= 0 && c.MaxArgs < c.MinArgs {
+		errs = append(errs, fmt.Errorf("%s: MaxArgs %d is less than MinArgs %d", where, c.MaxArgs, c.MinArgs))
+	}
+	if _, ok := c.lookupSubCommand(c.DefaultSubCommand); c.DefaultSubCommand != "" && !ok {
+		errs = append(errs, fmt.Errorf("%s: default sub-command %q does not exist", where, c.DefaultSubCommand))
+	}
+	for _, name := range c.RequiredFlags {
+		if c.Flags == nil || c.Flags.Lookup(name) == nil {
+			errs = append(errs, fmt.Errorf("%s: required flag -%s is not defined", where, name))
+		}
+	}
+	for _, name := range c.OwnFlags {
+		if c.Flags == nil || c.Flags.Lookup(name) == nil {
+			errs = append(errs, fmt.Errorf("%s: own flag -%s is not defined", where, name))
+		}
+	}
+	for _, group := range c.MutuallyExclusive {
+		for _, name := range group {
+			if c.Flags == nil || c.Flags.Lookup(name) == nil {
+				errs = append(errs, fmt.Errorf("%s: mutually exclusive flag -%s is not defined", where, name))
+			}
+		}
+	}
+	for _, n := range c.subCommandNames() {
+		if sc := c.SubCommands[n]; sc.Name != n {
+			errs = append(errs, fmt.Errorf("%s: sub-command %q has Name %q", where, n, sc.Name))
+		}
+	}
+
+	// every name and alias must resolve to exactly one subcommand
+	owner := map[string]string{}
+	for _, n := range c.subCommandNames() {
+		owner[n] = n
+	}
+	for _, n := range c.subCommandNames() {
+		for _, a := range c.SubCommands[n].Aliases {
+			if o, ok := owner[a]; ok && o != n {
+				errs = append(errs, fmt.Errorf("%s: alias %q of %q collides with %q", where, a, n, o))
+				continue
+			}
+			owner[a] = n
+		}
+	}
+
+	// a sub-command must not share a name with a flag, which would leave
+	// users unsure which they are giving
+	if c.Flags != nil {
+		for _, n := range c.subCommandNames() {
+			for _, name := range append([]string{n}, c.SubCommands[n].Aliases...) {
+				if f := c.Flags.Lookup(name); f != nil && !isBuiltinFlag(f) {
+					errs = append(errs, fmt.Errorf("%s: sub-command name %q is also the name of a flag", where, name))
+				}
+			}
+		}
+	}
+
+	for _, n := range c.subCommandNames() {
+		errs = append(errs, c.SubCommands[n].validate(append(path[:len(path):len(path)], n), ancestors)...)
+	}
+	return errs
+}
+
+// isBuiltinFlag reports whether f is a help or version flag added by
+// ProcessArgs.
+func isBuiltinFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *helpFlag, *versionFlag:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package commandflags
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+// SkipSubCommands may be returned by the function passed to Walk to skip the
+// sub-commands of the command it was called for. It is not returned by Walk.
+var SkipSubCommands = errors.New("skip sub-commands")
+
+// Walk calls fn for the command and each of its descendants, depth first and
+// in help order, with the names of the commands from c to each. Hidden
+// commands are included. If fn returns SkipSubCommands the descendants of
+// that command are skipped; any other error stops the walk and is returned.
+// A tree deeper than MaxDepth stops the walk with an error.
+func (c CommandType) Walk(fn func(path []string, cmd CommandType) error) error {
+	err := c.walk([]string{c.Name}, fn)
+	if err == SkipSubCommands {
+		return nil
+	}
+	return err
+}
+
+func (c CommandType) walk(path []string, fn func([]string, CommandType) error) error {
+	if err := tooDeep(path); err != nil {
+		return err
+	}
+	if err := fn(path, c); err != nil {
+		return err
+	}
+	for _, n := range c.subCommandNames() {
+		err := c.SubCommands[n].walk(append(path[:len(path):len(path)], n), fn)
+		if err != nil && err != SkipSubCommands {
+			return err
+		}
+	}
+	return nil
+}
+
+// LeafInfo describes a command without sub-commands, as returned by Leaves.
+type LeafInfo struct {
+	Path      []string // names of the commands from the tree's root to the leaf
+	ShortDesc string
+	Flags     int // number of flags the leaf defines
+}
+
+// Leaves returns the commands in the tree that have no sub-commands, in help
+// order, such as for listing every runnable command. Hidden commands, and
+// the descendants of hidden commands, are included only if includeHidden is
+// set. A tree deeper than MaxDepth is cut off at that depth.
+func (c CommandType) Leaves(includeHidden bool) []LeafInfo {
+	leaves := []LeafInfo{}
+	c.Walk(func(path []string, cmd CommandType) error {
+		if cmd.Hidden && !includeHidden {
+			return SkipSubCommands
+		}
+		if len(cmd.SubCommands) == 0 {
+			flags := 0
+			cmd.allFlags(func(*flag.Flag) { flags++ })
+			leaves = append(leaves, LeafInfo{Path: path, ShortDesc: cmd.ShortDesc, Flags: flags})
+		}
+		return nil
+	})
+	return leaves
+}
+
+// Index returns every command in the tree keyed by its path, the names of
+// the commands from c to it joined by spaces, e.g. "example deployments
+// status", for dispatching on a known path without processing arguments.
+// Each command is also keyed by its path with its own name replaced by each
+// of its Aliases, pointing at the same command; the paths of its
+// descendants use only its name. Hidden commands are included. The commands
+// are copies, so changing them does not change the tree. A tree deeper than
+// MaxDepth is cut off at that depth.
+func (c CommandType) Index() map[string]*CommandType {
+	index := map[string]*CommandType{}
+	c.Walk(func(path []string, cmd CommandType) error {
+		p := &cmd
+		index[strings.Join(path, " ")] = p
+		parent := strings.Join(path[:len(path)-1], " ")
+		for _, a := range cmd.Aliases {
+			index[strings.TrimPrefix(parent+" "+a, " ")] = p
+		}
+		return nil
+	})
+	return index
+}
+
+// TreeStats summarizes a command tree, as returned by Stats.
+type TreeStats struct {
+	Commands int // number of commands, including the root
+	MaxDepth int // length of the longest command path, 1 for the root alone
+	Flags    int // number of distinct flags, counting a shared FlagSet's once
+	Leaves   int // number of commands without sub-commands
+}
+
+// Stats counts the commands, flags and leaves of the tree and finds its
+// depth, for summaries or for checks such as a limit on the depth. Hidden
+// commands are included. A tree deeper than MaxDepth is cut off at that
+// depth.
+func (c CommandType) Stats() TreeStats {
+	stats := TreeStats{}
+	flags := map[*flag.Flag]bool{}
+	c.Walk(func(path []string, cmd CommandType) error {
+		stats.Commands++
+		if len(path) > stats.MaxDepth {
+			stats.MaxDepth = len(path)
+		}
+		if len(cmd.SubCommands) == 0 {
+			stats.Leaves++
+		}
+		cmd.allFlags(func(f *flag.Flag) { flags[f] = true })
+		return nil
+	})
+	stats.Flags = len(flags)
+	return stats
+}